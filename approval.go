@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultApprovalTimeout = 2 * time.Minute
+
+// ApprovalConfig holds sensitive tool calls until a human approves them
+type ApprovalConfig struct {
+	// Tools are tool name patterns that always need approval, such as "browser_file_upload"
+	Tools []string `json:"tools,omitempty"`
+	// URLs are regular expressions; calls with a matching url argument need approval
+	URLs []string `json:"urls,omitempty"`
+	// Timeout after which a held call is rejected, 2m by default
+	Timeout Duration `json:"timeout,omitempty"`
+	// Notify shows a desktop notification for each held call
+	Notify bool `json:"notify,omitempty"`
+}
+
+// pendingApproval describes a held call to the control socket's clients
+type pendingApproval struct {
+	ID        string    `json:"id"`
+	Tool      string    `json:"tool"`
+	Arguments string    `json:"arguments,omitempty"`
+	Requested time.Time `json:"requested"`
+
+	decision chan string
+}
+
+// Approvals holds tool calls that need a human decision
+type Approvals struct {
+	logger  *Logger
+	tools   []string
+	urls    []*regexp.Regexp
+	timeout time.Duration
+	notify  bool
+	// events receives an approval_pending event per held call, nil when nobody listens
+	events eventSink
+	// redactor hides the held call's sensitive arguments wherever they are shown
+	redactor *Redactor
+
+	mu      sync.Mutex
+	seq     int
+	pending map[string]*pendingApproval
+}
+
+// NewApprovals creates the approval gate, or returns nil when nothing needs approval
+func NewApprovals(config *ApprovalConfig, logger *Logger) (*Approvals, error) {
+	if config == nil || (len(config.Tools) == 0 && len(config.URLs) == 0) {
+		return nil, nil
+	}
+	a := &Approvals{
+		logger:  logger,
+		tools:   config.Tools,
+		timeout: time.Duration(config.Timeout),
+		notify:  config.Notify,
+		pending: make(map[string]*pendingApproval),
+	}
+	if a.timeout <= 0 {
+		a.timeout = defaultApprovalTimeout
+	}
+	for _, pattern := range config.Tools {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid approval tool pattern %q: %v", pattern, err)
+		}
+	}
+	for _, pattern := range config.URLs {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid approval URL pattern %q: %v", pattern, err)
+		}
+		a.urls = append(a.urls, re)
+	}
+	return a, nil
+}
+
+// required reports whether the call needs approval
+func (a *Approvals) required(call *toolCall) bool {
+	return a != nil && a.rule(call) != ""
+}
+
+// rule describes the setting that makes the call need approval, "" if none does
+func (a *Approvals) rule(call *toolCall) string {
+	for _, pattern := range a.tools {
+		if ok, _ := path.Match(pattern, call.Name); ok {
+			return fmt.Sprintf("tools pattern %q", pattern)
+		}
+	}
+	target := call.stringArg("url")
+	for _, re := range a.urls {
+		if target != "" && re.MatchString(target) {
+			return fmt.Sprintf("urls pattern %q", re.String())
+		}
+	}
+	return ""
+}
+
+// Wait blocks until the call is decided and returns why it was rejected, or "" if it may
+// proceed. A nil gate approves everything.
+func (a *Approvals) Wait(call *toolCall) string {
+	if a == nil || !a.required(call) {
+		return ""
+	}
+	arguments := a.redactedArguments(call)
+	a.mu.Lock()
+	a.seq++
+	request := &pendingApproval{
+		ID:        strconv.Itoa(a.seq),
+		Tool:      call.Name,
+		Arguments: arguments,
+		Requested: clockNow(),
+		decision:  make(chan string, 1),
+	}
+	a.pending[request.ID] = request
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, request.ID)
+		a.mu.Unlock()
+	}()
+
+	a.logger.Log("Holding %s call %s for approval: %s", call.Name, request.ID, request.Arguments)
+	fmt.Fprintf(os.Stderr, "playwrightwrap: %s %s needs approval, run `playwrightwrap approve %s` or `playwrightwrap deny %s`\n", call.Name, request.Arguments, request.ID, request.ID)
+	if a.notify {
+		if err := desktopNotify("playwrightwrap approval", fmt.Sprintf("%s %s (approve %s)", call.Name, request.Arguments, request.ID)); err != nil {
+			a.logger.Log("Desktop notification failed: %v", err)
+		}
+	}
+	if a.events != nil {
+		a.events.Publish(eventApprovalPending, map[string]interface{}{"id": request.ID, "tool": call.Name, "arguments": request.Arguments})
+	}
+
+	select {
+	case reason := <-request.decision:
+		if reason == "" {
+			a.logger.Log("Call %s approved", request.ID)
+		} else {
+			a.logger.Log("Call %s denied: %s", request.ID, reason)
+		}
+		return reason
+	case <-time.After(a.timeout):
+		a.logger.Log("Call %s was not approved within %v", request.ID, a.timeout)
+		return fmt.Sprintf("%s was not approved within %v", call.Name, a.timeout)
+	}
+}
+
+// redactedArguments encodes the call's arguments with the log redaction applied. The
+// call is redacted as the tools/call message it came in, so that field paths anchored at
+// the message match.
+func (a *Approvals) redactedArguments(call *toolCall) string {
+	message, _ := json.Marshal(map[string]interface{}{"method": "tools/call", "params": call})
+	var redacted struct {
+		Params struct {
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(a.redactor.JSON(redactLogs, message), &redacted); err != nil || redacted.Params.Arguments == nil {
+		return "{}"
+	}
+	return string(redacted.Params.Arguments)
+}
+
+// Pending lists the held calls, oldest first
+func (a *Approvals) Pending() []*pendingApproval {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	list := make([]*pendingApproval, 0, len(a.pending))
+	for i := 1; i <= a.seq; i++ {
+		if request, ok := a.pending[strconv.Itoa(i)]; ok {
+			list = append(list, request)
+		}
+	}
+	return list
+}
+
+// Decide releases a held call, forwarding it if approved
+func (a *Approvals) Decide(id string, approve bool, reason string) error {
+	a.mu.Lock()
+	request, ok := a.pending[id]
+	a.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no call %s is waiting for approval", id)
+	}
+	if !approve {
+		if reason == "" {
+			reason = "denied"
+		}
+		reason = fmt.Sprintf("%s was denied by the user: %s", request.Tool, reason)
+	}
+	select {
+	case request.decision <- reason:
+		return nil
+	default:
+		return fmt.Errorf("call %s was already decided", id)
+	}
+}
+
+// register adds the approval commands to the control socket
+func (a *Approvals) register(control *ControlServer) {
+	control.Handle("pending", func(*controlRequest) (interface{}, error) {
+		return a.Pending(), nil
+	})
+	control.Handle("approve", func(request *controlRequest) (interface{}, error) {
+		return nil, a.Decide(request.ID, true, "")
+	})
+	control.Handle("deny", func(request *controlRequest) (interface{}, error) {
+		return nil, a.Decide(request.ID, false, request.Reason)
+	})
+}
+
+// runApprove implements "playwrightwrap approve [id]", listing the held calls without an id
+func runApprove(args []string) int {
+	return decideCommand("approve", args)
+}
+
+// runDeny implements "playwrightwrap deny <id>"
+func runDeny(args []string) int {
+	return decideCommand("deny", args)
+}
+
+func decideCommand(command string, args []string) int {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket of the session, found automatically when only one is running")
+	reason := flags.String("reason", "", "reason given to the agent for a denial")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	path, err := findControlSocket(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		return 1
+	}
+
+	if flags.NArg() == 0 {
+		if command == "deny" {
+			fmt.Fprintln(os.Stderr, "Usage: playwrightwrap deny [flags] <id>")
+			return 2
+		}
+		result, err := controlCall(path, &controlRequest{Command: "pending"})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list pending calls: %v\n", err)
+			return 1
+		}
+		var pending []*pendingApproval
+		if err := json.Unmarshal(result, &pending); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list pending calls: %v\n", err)
+			return 1
+		}
+		if len(pending) == 0 {
+			fmt.Println("No calls are waiting for approval")
+		}
+		for _, p := range pending {
+			fmt.Printf("%s\t%s\t%s\t%s\n", p.ID, p.Requested.Format(time.TimeOnly), p.Tool, p.Arguments)
+		}
+		return 0
+	}
+
+	if _, err := controlCall(path, &controlRequest{Command: command, ID: flags.Arg(0), Reason: *reason}); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("session socket %s is gone", path)
+		}
+		fmt.Fprintf(os.Stderr, "Failed to %s call %s: %v\n", command, flags.Arg(0), err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// writeFileAtomic replaces path with data so that readers and crashes see either the
+// old or the new content, never part of it. The data goes to a synced temp file next to
+// path, which is renamed over it. Where path cannot be renamed over, as with a file
+// bind-mounted from another file system, the synced data is copied into it instead.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := createTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return diskFull(err, path)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if err := writeSynced(tmp, data, perm); err != nil {
+		return diskFull(err, path)
+	}
+	err = os.Rename(tmpPath, path)
+	if errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EBUSY) {
+		return copyInPlace(path, data, perm)
+	}
+	if err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// writeSynced writes data to file, flushes it to disk and closes it
+func writeSynced(file *os.File, data []byte, perm os.FileMode) error {
+	_, err := file.Write(data)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// copyInPlace overwrites path with data. It is only used once the same data was
+// written in full next to path, so a full file system has already been ruled out.
+func copyInPlace(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	return diskFull(writeSynced(file, data, perm), path)
+}
+
+// syncDir makes a rename in dir durable; not every platform can sync a directory
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// diskFull explains a write that failed because the file system holding path is full
+func diskFull(err error, path string) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("the file system holding %s is full, %s was left unchanged: %v", filepath.Dir(path), filepath.Base(path), err)
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// defaultResultSignal matches tool results that report cookies being set
+const defaultResultSignal = `(?i)set-cookie`
+
+// AuthDetector flags the session state as dirty when the proxy sees signs of a
+// login or credential refresh
+type AuthDetector struct {
+	urlPatterns    []*regexp.Regexp
+	resultPatterns []*regexp.Regexp
+
+	mu      sync.Mutex
+	signals []string
+}
+
+// NewAuthDetector compiles the configured signals, or returns nil when none are configured
+func NewAuthDetector(config *AuthSignalsConfig) (*AuthDetector, error) {
+	if config == nil {
+		return nil, nil
+	}
+	d := &AuthDetector{}
+	for _, pattern := range config.URLs {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth signal URL pattern %q: %v", pattern, err)
+		}
+		d.urlPatterns = append(d.urlPatterns, re)
+	}
+	resultPatterns := config.Results
+	if resultPatterns == nil {
+		resultPatterns = []string{defaultResultSignal}
+	}
+	for _, pattern := range resultPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth signal result pattern %q: %v", pattern, err)
+		}
+		d.resultPatterns = append(d.resultPatterns, re)
+	}
+	return d, nil
+}
+
+// Observe checks a successful tool call and returns the signal it matched, if any.
+// A nil detector observes nothing.
+func (d *AuthDetector) Observe(call *toolCall, resultText string) string {
+	if d == nil {
+		return ""
+	}
+	signal := ""
+	if target := call.stringArg("url"); target != "" && call.Name == "browser_navigate" {
+		for _, re := range d.urlPatterns {
+			if re.MatchString(target) {
+				signal = "navigation to " + target
+				break
+			}
+		}
+	}
+	if signal == "" {
+		for _, re := range d.resultPatterns {
+			if re.MatchString(resultText) {
+				signal = fmt.Sprintf("%s result matching %q", call.Name, re.String())
+				break
+			}
+		}
+	}
+	if signal != "" {
+		d.mu.Lock()
+		d.signals = append(d.signals, signal)
+		d.mu.Unlock()
+	}
+	return signal
+}
+
+// Signals returns everything observed so far
+func (d *AuthDetector) Signals() []string {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.signals...)
+}
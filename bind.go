@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// bindHost resolves the address to listen on: host itself, or the first address of the
+// named interface, IPv4 before IPv6
+func bindHost(host, iface string) (string, error) {
+	if iface == "" {
+		if host == "" {
+			return defaultRunAllHost, nil
+		}
+		// Accept IPv6 addresses written for URLs too
+		return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), nil
+	}
+	if host != "" {
+		return "", fmt.Errorf("--host and --interface cannot be combined")
+	}
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var ipv6 string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+		if ipv6 == "" {
+			ipv6 = ipnet.IP.String()
+			if ipnet.IP.IsLinkLocalUnicast() {
+				ipv6 += "%" + iface
+			}
+		}
+	}
+	if ipv6 == "" {
+		return "", fmt.Errorf("interface %s has no addresses", iface)
+	}
+	return ipv6, nil
+}
+
+// isLoopbackHost reports whether host only accepts connections from this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// warnExposed warns that what listens on host can be reached from other machines with
+// neither TLS nor authentication in the way
+func warnExposed(what, host string) {
+	if isLoopbackHost(host) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "playwrightwrap: warning: %s listens on %s, which is not a loopback address, without TLS or authentication; anyone who can reach it controls the browser\n", what, host)
+}
+
+// flagValue returns the value of the last --name or --name value argument, empty when absent
+func flagValue(args []string, name string) string {
+	value := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == name && i+1 < len(args) {
+			value = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], name+"=") {
+			value = strings.TrimPrefix(args[i], name+"=")
+		}
+	}
+	return value
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chromiumBrowser describes where a Chromium based browser keeps its data
+type chromiumBrowser struct {
+	// dataDirs are the user data directories per GOOS, relative to the home directory
+	dataDirs map[string]string
+	// keyringName is the application name used for the cookie key in the OS keyring
+	keyringName string
+}
+
+var chromiumBrowsers = map[string]chromiumBrowser{
+	"chrome": {
+		dataDirs: map[string]string{
+			"linux":   ".config/google-chrome",
+			"darwin":  "Library/Application Support/Google/Chrome",
+			"windows": "AppData/Local/Google/Chrome/User Data",
+		},
+		keyringName: "Chrome",
+	},
+	"edge": {
+		dataDirs: map[string]string{
+			"linux":   ".config/microsoft-edge",
+			"darwin":  "Library/Application Support/Microsoft Edge",
+			"windows": "AppData/Local/Microsoft/Edge/User Data",
+		},
+		keyringName: "Microsoft Edge",
+	},
+}
+
+var firefoxProfileDirs = map[string]string{
+	"linux":   ".mozilla/firefox",
+	"darwin":  "Library/Application Support/Firefox/Profiles",
+	"windows": "AppData/Roaming/Mozilla/Firefox/Profiles",
+}
+
+// chromeEpochOffset is the number of seconds between 1601-01-01 and the Unix epoch
+const chromeEpochOffset = 11644473600
+
+// runImport implements "playwrightwrap import", merging cookies from an installed
+// browser, a HAR capture or a cookie jar into a profile
+func runImport(args []string) int {
+	usage := "Usage: playwrightwrap import chrome|firefox|edge|har <file>|cookiejar <file> [--profile name] [--domains a.com,b.com] [--browser-profile dir] [--replace]"
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	source := args[0]
+	rest := args[1:]
+	sourceFile := ""
+	if source == "har" || source == "cookiejar" {
+		if len(rest) == 0 || strings.HasPrefix(rest[0], "-") {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		sourceFile = rest[0]
+		rest = rest[1:]
+	}
+
+	flags := flag.NewFlagSet("import "+source, flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "wrapper profile to write the storage state to")
+	domains := flags.String("domains", "", "comma separated domains to import cookies for, all when empty")
+	browserProfile := flags.String("browser-profile", "", "browser profile directory name or path, the default profile when empty")
+	replace := flags.Bool("replace", false, "replace the profile's storage state instead of merging into it")
+	if err := flags.Parse(rest); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	var cookies []Cookie
+	switch source {
+	case "chrome", "edge":
+		cookies, err = readChromiumCookies(chromiumBrowsers[source], *browserProfile)
+	case "firefox":
+		cookies, err = readFirefoxCookies(*browserProfile)
+	case "har":
+		cookies, err = readHARCookies(sourceFile)
+	case "cookiejar":
+		var file *os.File
+		if file, err = os.Open(sourceFile); err == nil {
+			cookies, err = parseNetscapeJar(file)
+			file.Close()
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported source %q, expected chrome, firefox, edge, har or cookiejar\n", source)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s cookies: %v\n", source, err)
+		return 1
+	}
+
+	domainList := splitList(*domains)
+	imported := &StorageState{}
+	for _, cookie := range cookies {
+		if matchesDomain(cookie.Domain, domainList) {
+			imported.Cookies = append(imported.Cookies, cookie)
+		}
+	}
+	sort.SliceStable(imported.Cookies, func(i, j int) bool {
+		return imported.Cookies[i].Domain < imported.Cookies[j].Domain
+	})
+
+	target := config.storageStatePath(*profile)
+	state := imported
+	if !*replace {
+		existing, err := loadStorageState(target)
+		if err == nil {
+			state = mergeStorageState(existing, imported)
+		} else if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to read storage state %s: %v\n", target, err)
+			return 1
+		}
+	}
+	if err := state.save(target); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write storage state %s: %v\n", target, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d cookies from %s into %s\n", len(imported.Cookies), source, target)
+	return 0
+}
+
+// readChromiumCookies reads and decrypts the cookie store of a Chromium based browser
+func readChromiumCookies(browser chromiumBrowser, profileDir string) ([]Cookie, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	dataDir, ok := browser.dataDirs[runtime.GOOS]
+	if !ok {
+		return nil, fmt.Errorf("unsupported platform %s", runtime.GOOS)
+	}
+	dataDir = filepath.Join(home, filepath.FromSlash(dataDir))
+	if profileDir == "" {
+		profileDir = "Default"
+	}
+	if !filepath.IsAbs(profileDir) {
+		profileDir = filepath.Join(dataDir, profileDir)
+	}
+
+	dbPath := filepath.Join(profileDir, "Network", "Cookies")
+	if _, err := os.Stat(dbPath); err != nil {
+		dbPath = filepath.Join(profileDir, "Cookies")
+	}
+
+	var rows []struct {
+		Host      string `json:"host_key"`
+		Name      string `json:"name"`
+		Value     string `json:"value"`
+		Encrypted string `json:"encrypted_value"`
+		Path      string `json:"path"`
+		Expires   int64  `json:"expires_utc"`
+		Secure    int    `json:"is_secure"`
+		HTTPOnly  int    `json:"is_httponly"`
+		SameSite  int    `json:"samesite"`
+	}
+	err = querySQLite(dbPath, "SELECT host_key, name, value, hex(encrypted_value) AS encrypted_value, path, expires_utc, is_secure, is_httponly, samesite FROM cookies", &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Since database version 24 the plaintext is prefixed with a SHA-256 of the host
+	var meta []struct {
+		Value string `json:"value"`
+	}
+	querySQLite(dbPath, "SELECT value FROM meta WHERE key = 'version'", &meta)
+	hashPrefix := false
+	if len(meta) > 0 {
+		if version, err := strconv.Atoi(meta[0].Value); err == nil && version >= 24 {
+			hashPrefix = true
+		}
+	}
+
+	decrypter := &chromiumDecrypter{browser: browser, dataDir: dataDir}
+	var cookies []Cookie
+	for _, row := range rows {
+		value := row.Value
+		if value == "" && row.Encrypted != "" {
+			encrypted, err := hex.DecodeString(row.Encrypted)
+			if err != nil {
+				return nil, err
+			}
+			plain, err := decrypter.decrypt(encrypted)
+			if err != nil {
+				return nil, fmt.Errorf("cookie %s on %s: %v", row.Name, row.Host, err)
+			}
+			if hashPrefix && len(plain) >= 32 {
+				plain = plain[32:]
+			}
+			value = string(plain)
+		}
+
+		expires := float64(-1)
+		if row.Expires > 0 {
+			expires = float64(row.Expires/1000000 - chromeEpochOffset)
+		}
+		cookies = append(cookies, Cookie{
+			Name:     row.Name,
+			Value:    value,
+			Domain:   row.Host,
+			Path:     row.Path,
+			Expires:  expires,
+			HTTPOnly: row.HTTPOnly != 0,
+			Secure:   row.Secure != 0,
+			SameSite: sameSiteName(row.SameSite),
+		})
+	}
+	return cookies, nil
+}
+
+// chromiumDecrypter decrypts cookie values, fetching the key on first use
+type chromiumDecrypter struct {
+	browser chromiumBrowser
+	dataDir string
+	keys    map[string][]byte
+}
+
+// decrypt decrypts an encrypted_value column, dispatching on its version prefix
+func (d *chromiumDecrypter) decrypt(encrypted []byte) ([]byte, error) {
+	if d.keys == nil {
+		d.keys = make(map[string][]byte)
+	}
+	if len(encrypted) < 3 {
+		return nil, errors.New("encrypted value too short")
+	}
+	return d.decryptValue(string(encrypted[:3]), encrypted)
+}
+
+// decryptAESCBC decrypts a Chromium AES-128-CBC value with its fixed IV
+func decryptAESCBC(key []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("ciphertext is not a multiple of the block size")
+	}
+	iv := []byte(strings.Repeat(" ", aes.BlockSize))
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plain) {
+		return nil, errors.New("invalid padding, the keyring password is probably wrong")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// decryptAESGCM decrypts a value of the form nonce || ciphertext || tag
+func decryptAESGCM(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// readFirefoxCookies reads the cookie store of a Firefox profile
+func readFirefoxCookies(profileDir string) ([]Cookie, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	root, ok := firefoxProfileDirs[runtime.GOOS]
+	if !ok {
+		return nil, fmt.Errorf("unsupported platform %s", runtime.GOOS)
+	}
+	root = filepath.Join(home, filepath.FromSlash(root))
+	if profileDir == "" {
+		profileDir, err = defaultFirefoxProfile(root)
+		if err != nil {
+			return nil, err
+		}
+	} else if !filepath.IsAbs(profileDir) {
+		profileDir = filepath.Join(root, profileDir)
+	}
+
+	var rows []struct {
+		Host     string `json:"host"`
+		Name     string `json:"name"`
+		Value    string `json:"value"`
+		Path     string `json:"path"`
+		Expiry   int64  `json:"expiry"`
+		Secure   int    `json:"isSecure"`
+		HTTPOnly int    `json:"isHttpOnly"`
+		SameSite int    `json:"sameSite"`
+	}
+	err = querySQLite(filepath.Join(profileDir, "cookies.sqlite"), "SELECT host, name, value, path, expiry, isSecure, isHttpOnly, sameSite FROM moz_cookies", &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var cookies []Cookie
+	for _, row := range rows {
+		expires := float64(row.Expiry)
+		// Recent Firefox versions store the expiry in milliseconds
+		if expires > 1e11 {
+			expires /= 1000
+		}
+		sameSite := "None"
+		switch row.SameSite {
+		case 1:
+			sameSite = "Lax"
+		case 2:
+			sameSite = "Strict"
+		}
+		cookies = append(cookies, Cookie{
+			Name:     row.Name,
+			Value:    row.Value,
+			Domain:   row.Host,
+			Path:     row.Path,
+			Expires:  expires,
+			HTTPOnly: row.HTTPOnly != 0,
+			Secure:   row.Secure != 0,
+			SameSite: sameSite,
+		})
+	}
+	return cookies, nil
+}
+
+// defaultFirefoxProfile picks the profile directory holding cookies, preferring default-release
+func defaultFirefoxProfile(root string) (string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return "", err
+	}
+	var candidates []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, entry.Name(), "cookies.sqlite")); err == nil {
+			candidates = append(candidates, entry.Name())
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no Firefox profile with cookies found in %s", root)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return strings.HasSuffix(candidates[i], ".default-release") && !strings.HasSuffix(candidates[j], ".default-release")
+	})
+	return filepath.Join(root, candidates[0]), nil
+}
+
+// sameSiteName converts Chromium's samesite column to Playwright's notation
+func sameSiteName(value int) string {
+	switch value {
+	case 0:
+		return "None"
+	case 2:
+		return "Strict"
+	default:
+		return "Lax"
+	}
+}
+
+// querySQLite runs a query with the sqlite3 command line tool against a copy of the
+// database, since browsers keep their cookie store locked while running
+func querySQLite(dbPath string, query string, rows interface{}) error {
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return errors.New("the sqlite3 command line tool is required to read browser cookie stores")
+	}
+
+	tmpDir, err := mkdirTemp("", "playwrightwrap-import-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	copyPath := filepath.Join(tmpDir, "cookies.db")
+	if err := copyFile(dbPath, copyPath); err != nil {
+		return err
+	}
+	copyFile(dbPath+"-wal", copyPath+"-wal")
+
+	out, err := exec.Command(sqlite, "-readonly", "-json", copyPath, query).Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("sqlite3: %s", strings.TrimSpace(string(exitError.Stderr)))
+		}
+		return err
+	}
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return nil
+	}
+	return json.Unmarshal(out, rows)
+}
+
+// copyFile copies src to dst, readable by the owner only
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// decryptValue decrypts a v10/v11 cookie value with the AES key derived from the
+// browser's password, as used on macOS and Linux
+func (d *chromiumDecrypter) decryptValue(version string, encrypted []byte) ([]byte, error) {
+	if version != "v10" && version != "v11" {
+		return nil, fmt.Errorf("unsupported encryption version %q", version)
+	}
+	key, ok := d.keys[version]
+	if !ok {
+		password, iterations, err := chromiumPassword(d.browser, version)
+		if err != nil {
+			return nil, err
+		}
+		key, err = pbkdf2.Key(sha1.New, password, []byte("saltysalt"), iterations, 16)
+		if err != nil {
+			return nil, err
+		}
+		d.keys[version] = key
+	}
+	return decryptAESCBC(key, encrypted[3:])
+}
+
+// chromiumPassword fetches the cookie encryption password from the OS keyring and
+// returns it with the PBKDF2 iteration count of the platform
+func chromiumPassword(browser chromiumBrowser, version string) (string, int, error) {
+	if runtime.GOOS == "darwin" {
+		out, err := exec.Command("security", "find-generic-password", "-w", "-s", browser.keyringName+" Safe Storage").Output()
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read %s Safe Storage from the keychain: %v", browser.keyringName, err)
+		}
+		return strings.TrimSpace(string(out)), 1003, nil
+	}
+
+	// v10 values use a hardcoded password, v11 values the one stored in the Secret Service
+	if version == "v10" {
+		return "peanuts", 1, nil
+	}
+	application := strings.ReplaceAll(strings.ToLower(browser.keyringName), " ", "-")
+	out, err := exec.Command("secret-tool", "lookup", "application", application).Output()
+	if err != nil || len(strings.TrimSpace(string(out))) == 0 {
+		return "", 0, fmt.Errorf("failed to read the %s key with secret-tool (is libsecret-tools installed and the keyring unlocked?)", browser.keyringName)
+	}
+	return strings.TrimSpace(string(out)), 1, nil
+}
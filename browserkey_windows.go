@@ -0,0 +1,83 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var procCryptUnprotectData = syscall.NewLazyDLL("crypt32.dll").NewProc("CryptUnprotectData")
+
+// dataBlob mirrors the Windows DATA_BLOB structure
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+// decryptValue decrypts a cookie value with the AES-GCM key from Local State, or
+// with DPAPI directly for values written by old browser versions
+func (d *chromiumDecrypter) decryptValue(version string, encrypted []byte) ([]byte, error) {
+	switch version {
+	case "v10":
+		key, ok := d.keys[version]
+		if !ok {
+			var err error
+			key, err = localStateKey(d.dataDir)
+			if err != nil {
+				return nil, err
+			}
+			d.keys[version] = key
+		}
+		return decryptAESGCM(key, encrypted[3:])
+	case "v20":
+		return nil, errors.New("app-bound encrypted cookies (v20) cannot be decrypted outside the browser")
+	default:
+		return unprotectData(encrypted)
+	}
+}
+
+// localStateKey reads and unprotects the cookie key stored in the Local State file
+func localStateKey(dataDir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, "Local State"))
+	if err != nil {
+		return nil, err
+	}
+	var localState struct {
+		OSCrypt struct {
+			EncryptedKey string `json:"encrypted_key"`
+		} `json:"os_crypt"`
+	}
+	if err := json.Unmarshal(data, &localState); err != nil {
+		return nil, fmt.Errorf("invalid Local State: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(localState.OSCrypt.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Local State key: %v", err)
+	}
+	if len(key) < 5 || string(key[:5]) != "DPAPI" {
+		return nil, errors.New("Local State key is not DPAPI protected")
+	}
+	return unprotectData(key[5:])
+}
+
+// unprotectData decrypts data protected with DPAPI for the current user
+func unprotectData(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty DPAPI blob")
+	}
+	in := dataBlob{size: uint32(len(data)), data: &data[0]}
+	var out dataBlob
+	r, _, err := procCryptUnprotectData.Call(uintptr(unsafe.Pointer(&in)), 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("CryptUnprotectData: %v", err)
+	}
+	defer syscall.LocalFree(syscall.Handle(unsafe.Pointer(out.data)))
+	return append([]byte(nil), unsafe.Slice(out.data, out.size)...), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BudgetConfig caps what one session may do; zero means unlimited
+type BudgetConfig struct {
+	// ToolCalls is the maximum number of tool calls
+	ToolCalls int `json:"toolCalls,omitempty"`
+	// Navigations is the maximum number of browser_navigate calls
+	Navigations int `json:"navigations,omitempty"`
+}
+
+// Budget enforces the per-session quotas
+type Budget struct {
+	config *BudgetConfig
+
+	mu          sync.Mutex
+	toolCalls   int
+	navigations int
+	exceeded    string
+	rejected    int
+}
+
+// NewBudget creates a budget, or returns nil when no quota is configured
+func NewBudget(config *BudgetConfig) *Budget {
+	if config == nil || (config.ToolCalls <= 0 && config.Navigations <= 0) {
+		return nil
+	}
+	return &Budget{config: config}
+}
+
+// Allow counts a tool call against the budget and returns why it is rejected, or ""
+// if it may proceed. A nil budget allows everything.
+func (b *Budget) Allow(call *toolCall) string {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var reason string
+	switch {
+	case b.config.ToolCalls > 0 && b.toolCalls >= b.config.ToolCalls:
+		reason = fmt.Sprintf("the session's budget of %d tool calls is used up", b.config.ToolCalls)
+	case call.Name == "browser_navigate" && b.config.Navigations > 0 && b.navigations >= b.config.Navigations:
+		reason = fmt.Sprintf("the session's budget of %d navigations is used up", b.config.Navigations)
+	default:
+		b.toolCalls++
+		if call.Name == "browser_navigate" {
+			b.navigations++
+		}
+		return ""
+	}
+	if b.exceeded == "" {
+		b.exceeded = reason
+	}
+	b.rejected++
+	return reason
+}
+
+// Exceeded returns the first quota the session ran out of, "" if none, and how many
+// calls were rejected
+func (b *Budget) Exceeded() (string, int) {
+	if b == nil {
+		return "", 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded, b.rejected
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	bundleMagic      = "PWBUNDLE1\n"
+	ageMagic         = "age-encryption.org/"
+	bundleIterations = 600000
+	bundleManifest   = "manifest.json"
+	bundleState      = "storage_state.json"
+	bundleConfig     = "config.json"
+)
+
+// bundleMetadata describes the profile a bundle was exported from
+type bundleMetadata struct {
+	Profile    string    `json:"profile"`
+	ExportedAt time.Time `json:"exportedAt"`
+	ExportedBy string    `json:"exportedBy,omitempty"`
+}
+
+// profileBundle is the content of an exported profile
+type profileBundle struct {
+	Metadata bundleMetadata
+	State    []byte
+	Config   *ProfileConfig
+}
+
+// packBundle writes the bundle as a gzipped tar archive
+func packBundle(bundle *profileBundle) ([]byte, error) {
+	metadata, err := json.MarshalIndent(bundle.Metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.MarshalIndent(bundle.Config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{bundleManifest, metadata},
+		{bundleState, bundle.State},
+		{bundleConfig, config},
+	}
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0600, Size: int64(len(file.data)), ModTime: bundle.Metadata.ExportedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpackBundle reads a gzipped tar archive written by packBundle
+func unpackBundle(data []byte) (*profileBundle, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("not a profile bundle: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	bundle := &profileBundle{Config: &ProfileConfig{}}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		switch header.Name {
+		case bundleManifest:
+			err = json.Unmarshal(content, &bundle.Metadata)
+		case bundleState:
+			bundle.State = content
+		case bundleConfig:
+			err = json.Unmarshal(content, bundle.Config)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in bundle: %v", header.Name, err)
+		}
+	}
+	if bundle.State == nil {
+		return nil, errors.New("bundle contains no storage state")
+	}
+	return bundle, nil
+}
+
+// encryptWithPassphrase encrypts data with AES-256-GCM under a PBKDF2 derived key
+func encryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(bundleMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, []byte(bundleMagic)), nil
+}
+
+// decryptWithPassphrase reverses encryptWithPassphrase
+func decryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	data = data[len(bundleMagic):]
+	if len(data) < 16 {
+		return nil, errors.New("encrypted bundle is truncated")
+	}
+	gcm, err := passphraseCipher(passphrase, data[:16])
+	if err != nil {
+		return nil, err
+	}
+	data = data[16:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted bundle is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(bundleMagic))
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted bundle")
+	}
+	return plain, nil
+}
+
+func passphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, bundleIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// runAge pipes data through the age command line tool
+func runAge(data []byte, args ...string) ([]byte, error) {
+	age, err := exec.LookPath("age")
+	if err != nil {
+		return nil, errors.New("the age command line tool is required for age recipients and identities")
+	}
+	cmd := exec.Command(age, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("age: %s", strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// readPassphrase takes the passphrase from PLAYWRIGHTWRAP_PASSPHRASE or asks for it on
+// stdin, with the terminal echo off
+func readPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv("PLAYWRIGHTWRAP_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	restore := disableEcho()
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	restore()
+	fmt.Fprintln(os.Stderr)
+	if err != nil && line == "" {
+		return "", errors.New("no passphrase given")
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", errors.New("no passphrase given")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// defaultCachedTools only read the browser's state
+var defaultCachedTools = []string{"browser_snapshot", "browser_tab_list", "browser_console_messages", "browser_network_requests"}
+
+// CacheConfig answers repeated identical read-only calls from a short-lived cache
+type CacheConfig struct {
+	// TTL is how long a result is reused; caching is off when zero
+	TTL Duration `json:"ttl,omitempty"`
+	// Tools are the tool name patterns to cache, read-only tools by default
+	Tools []string `json:"tools,omitempty"`
+}
+
+// ResponseCache keeps the results of idempotent tool calls. Any other tool call may
+// change the page, so it drops every entry.
+type ResponseCache struct {
+	ttl   time.Duration
+	tools []string
+
+	mu         sync.Mutex
+	generation int
+	entries    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	result json.RawMessage
+	stored time.Time
+}
+
+// NewResponseCache creates a cache, or returns nil when caching is off
+func NewResponseCache(config *CacheConfig) *ResponseCache {
+	if config == nil || config.TTL <= 0 {
+		return nil
+	}
+	tools := config.Tools
+	if len(tools) == 0 {
+		tools = defaultCachedTools
+	}
+	return &ResponseCache{ttl: time.Duration(config.TTL), tools: tools, entries: make(map[string]cacheEntry)}
+}
+
+// key returns the cache key of the call, "" if it is not cacheable
+func (c *ResponseCache) key(call *toolCall) string {
+	if c == nil || !matchesTool(call.Name, c.tools) {
+		return ""
+	}
+	// Maps are marshaled with sorted keys, so equal arguments give equal keys
+	arguments, err := json.Marshal(call.Arguments)
+	if err != nil {
+		return ""
+	}
+	return call.Name + " " + string(arguments)
+}
+
+// Get returns a fresh cached result, nil if there is none
+func (c *ResponseCache) Get(key string) json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.stored) > c.ttl {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.result
+}
+
+// Put stores a result, unless the cache was invalidated since the call was made
+func (c *ResponseCache) Put(key string, generation int, result json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.entries[key] = cacheEntry{result: result, stored: time.Now()}
+	}
+}
+
+// Generation identifies the current cache contents
+func (c *ResponseCache) Generation() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Invalidate drops every entry. A nil cache does nothing.
+func (c *ResponseCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[string]cacheEntry)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultCacheMaxAge = 30 * 24 * time.Hour
+
+// Kinds of cached items
+const (
+	cacheNpx     = "npx"
+	cacheBrowser = "browser"
+	cacheSession = "session"
+)
+
+// cachedItem is one directory the wrapper's sessions leave behind
+type cachedItem struct {
+	kind     string
+	name     string
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// runCache implements "playwrightwrap cache <subcommand>"
+func runCache(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap cache list|prune [flags]")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return runCacheList(args[1:])
+	case "prune":
+		return runCachePrune(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runCacheList shows the npx installs of the MCP package, the browser builds and the
+// directories of sessions that did not clean up
+func runCacheList(args []string) int {
+	flags := flag.NewFlagSet("cache list", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile whose environment settings locate the caches")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	items, code := loadCache(*profile)
+	if code != 0 {
+		return code
+	}
+	printCache(items)
+	return 0
+}
+
+// runCachePrune removes cached items that were not modified within --older-than, and
+// every stale session directory
+func runCachePrune(args []string) int {
+	flags := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile whose environment settings locate the caches")
+	olderThan := flags.Duration("older-than", defaultCacheMaxAge, "remove npx installs and browsers not modified for this long")
+	dryRun := flags.Bool("dry-run", false, "only show what would be removed")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	items, code := loadCache(*profile)
+	if code != 0 {
+		return code
+	}
+	// A running session may still need any of the installs, whatever their age
+	running := 0
+	for _, session := range listSessions() {
+		if sessionAlive(session) {
+			running++
+		}
+	}
+	if running > 0 {
+		fmt.Fprintf(os.Stderr, "%d session(s) running, only pruning stale session directories\n", running)
+	}
+
+	cutoff := time.Now().Add(-*olderThan)
+	var removed []cachedItem
+	var freed int64
+	for _, item := range items {
+		if item.kind != cacheSession && (running > 0 || item.modified.After(cutoff)) {
+			continue
+		}
+		if !*dryRun {
+			if err := os.RemoveAll(item.path); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", item.path, err)
+				continue
+			}
+		}
+		removed = append(removed, item)
+		freed += item.size
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	for _, item := range removed {
+		fmt.Fprintf(os.Stderr, "%s %s %s (%s)\n", verb, item.kind, item.path, formatSize(item.size))
+	}
+	fmt.Fprintf(os.Stderr, "%s %d item(s), %s\n", verb, len(removed), formatSize(freed))
+	return 0
+}
+
+// loadCache finds the cached items with the profile's environment
+func loadCache(profile string) ([]cachedItem, int) {
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return nil, 1
+	}
+	env, _ := config.childEnv(profile)
+	items, err := collectCache(env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read caches: %v\n", err)
+		return nil, 1
+	}
+	return items, 0
+}
+
+// collectCache lists the npx installs that contain the MCP package, the browser builds
+// and the session directories whose wrapper is gone
+func collectCache(env []string) ([]cachedItem, error) {
+	var items []cachedItem
+	npx, _ := filepath.Glob(filepath.Join(npmCacheDir(env), "_npx", "*"))
+	for _, dir := range npx {
+		manifest := filepath.Join(dir, "node_modules", filepath.FromSlash(mcpPackage), "package.json")
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Version string `json:"version"`
+		}
+		json.Unmarshal(data, &pkg)
+		item, err := newCachedItem(cacheNpx, mcpPackage+"@"+pkg.Version, dir)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if dir := browsersDir(env); dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			item, err := newCachedItem(cacheBrowser, entry.Name(), filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+
+	for _, session := range listSessions() {
+		if sessionAlive(session) {
+			continue
+		}
+		item, err := newCachedItem(cacheSession, session.status.ID, session.dir)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// newCachedItem measures a directory, its age is that of its most recent change
+func newCachedItem(kind, name, path string) (cachedItem, error) {
+	item := cachedItem{kind: kind, name: name, path: path}
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			item.size += info.Size()
+		}
+		if info.ModTime().After(item.modified) {
+			item.modified = info.ModTime()
+		}
+		return nil
+	})
+	return item, err
+}
+
+// sessionAlive reports whether a session's wrapper still answers on its control socket
+func sessionAlive(session runningSession) bool {
+	conn, err := net.DialTimeout("unix", filepath.Join(session.dir, sessionSocketFile), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// npmCacheDir returns the npm cache npx installs packages into
+func npmCacheDir(env []string) string {
+	if dir := envValue(env, "npm_config_cache"); dir != "" {
+		return dir
+	}
+	if dir := envValue(env, "NPM_CONFIG_CACHE"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	if runtime.GOOS == "windows" {
+		return filepath.Join(envOr("LOCALAPPDATA", filepath.Join(home, "AppData", "Local")), "npm-cache")
+	}
+	return filepath.Join(home, ".npm")
+}
+
+// browsersDir returns where Playwright keeps its browser builds, "" when they are
+// installed inside node_modules
+func browsersDir(env []string) string {
+	switch dir := envValue(env, "PLAYWRIGHT_BROWSERS_PATH"); dir {
+	case "0":
+		return ""
+	case "":
+	default:
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Caches", "ms-playwright")
+	case "windows":
+		return filepath.Join(envOr("LOCALAPPDATA", filepath.Join(home, "AppData", "Local")), "ms-playwright")
+	default:
+		return filepath.Join(envValueOr(env, "XDG_CACHE_HOME", filepath.Join(home, ".cache")), "ms-playwright")
+	}
+}
+
+// envValue returns the last value of name in env, "" if it is not set
+func envValue(env []string, name string) string {
+	value := ""
+	for _, variable := range env {
+		if strings.HasPrefix(variable, name+"=") {
+			value = strings.TrimPrefix(variable, name+"=")
+		}
+	}
+	return value
+}
+
+func envValueOr(env []string, name, fallback string) string {
+	if value := envValue(env, name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// printCache shows the items by kind, largest first
+func printCache(items []cachedItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].kind != items[j].kind {
+			return items[i].kind < items[j].kind
+		}
+		return items[i].size > items[j].size
+	})
+	now := time.Now()
+	var total int64
+	fmt.Printf("%-8s %-32s %9s %8s  %s\n", "KIND", "NAME", "SIZE", "AGE", "PATH")
+	for _, item := range items {
+		age := now.Sub(item.modified).Truncate(time.Hour)
+		fmt.Printf("%-8s %-32s %9s %8s  %s\n", item.kind, item.name, formatSize(item.size), formatAge(age), item.path)
+		total += item.size
+	}
+	fmt.Printf("\n%d item(s), %s\n", len(items), formatSize(total))
+}
+
+// formatSize renders a byte count in binary units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, suffix := float64(size), "KMGT"
+	i := -1
+	for value >= unit && i < len(suffix)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", value, suffix[i])
+}
+
+// formatAge renders an age in days or hours
+func formatAge(age time.Duration) string {
+	if age >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+	return fmt.Sprintf("%dh", int(age.Hours()))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	defaultCallTimeout = 2 * time.Minute
+	callProtocol       = "2025-06-18"
+)
+
+// registerCallCommand adds the call command, which runs one tool call in the session
+// with the same checks as the client's calls
+func registerCallCommand(control *ControlServer, proxy *Proxy) {
+	control.Handle("call", func(request *controlRequest) (interface{}, error) {
+		if request.Tool == "" {
+			return nil, errors.New("no tool given")
+		}
+		select {
+		case <-proxy.Ready():
+		default:
+			return nil, errors.New("the session is not initialized yet")
+		}
+		call := &toolCall{Name: request.Tool, Arguments: request.Arguments}
+		if proxy.names != nil {
+			call.Name = proxy.names.original(call.Name)
+		}
+		policies := proxy.policies.Load()
+		if policies == nil {
+			policies = &proxyPolicies{}
+		}
+		proxy.stats.toolCalls.Add(1)
+		if reason := proxy.screenCall(call, policies); reason != "" {
+			proxy.stats.toolRejections.Add(1)
+			proxy.logger.Log("Rejected %s call from the control socket: %s", call.Name, reason)
+			return nil, errors.New(reason)
+		}
+		if reason := proxy.approvals.Wait(call); reason != "" {
+			proxy.stats.toolRejections.Add(1)
+			proxy.logger.Log("Rejected %s call from the control socket: %s", call.Name, reason)
+			return nil, errors.New(reason)
+		}
+		time.Sleep(proxy.paceNavigation(call, policies))
+		settings := policies.tools.settings(call.Name)
+		timeout := defaultCallTimeout
+		if settings.timeout > 0 {
+			timeout = settings.timeout
+		}
+		proxy.logger.Log("Calling %s for the control socket", call.Name)
+		result, err := proxy.CallTool(call.Name, call.Arguments, timeout)
+		if err != nil {
+			proxy.stats.toolErrors.Add(1)
+			return nil, errors.New(proxy.redactor.String(redactResponses, err.Error()))
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if max := settings.maxResponseSize; max > 0 && len(data) > max {
+			proxy.stats.toolErrors.Add(1)
+			return nil, fmt.Errorf("the %s result of %d bytes exceeds the limit of %d bytes", call.Name, len(data), max)
+		}
+		data = settings.redactor.JSON(redactResponses, data)
+		return json.RawMessage(proxy.redactor.JSON(redactResponses, data)), nil
+	})
+}
+
+// runCall implements "playwrightwrap call <tool>", running one tool call in a new
+// session, or in a running one with --attach, and printing its result
+func runCall(args []string) int {
+	usage := "Usage: playwrightwrap call <tool> [--json args.json] [--attach] [--socket path] [--raw] [--timeout 2m] [-- playwright args]"
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	tool := args[0]
+	flags := flag.NewFlagSet("call", flag.ContinueOnError)
+	argsFile := flags.String("json", "", "file with the tool's arguments as a JSON object, - for stdin")
+	attach := flags.Bool("attach", false, "call in the running session instead of starting one")
+	socket := flags.String("socket", "", "control socket of the session to attach to, implies --attach")
+	raw := flags.Bool("raw", false, "print the result as JSON instead of its text")
+	timeout := flags.Duration("timeout", defaultCallTimeout, "how long to wait for the session and the call")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	arguments := map[string]interface{}{}
+	if *argsFile != "" {
+		var data []byte
+		var err error
+		if *argsFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*argsFile)
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &arguments)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read arguments %s: %v\n", *argsFile, err)
+			return 2
+		}
+	}
+
+	var result *toolResult
+	var err error
+	if *attach || *socket != "" {
+		result, err = callAttached(*socket, tool, arguments, *timeout)
+	} else {
+		result, err = callInSession(flags.Args(), tool, arguments, *timeout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		return 1
+	}
+	if *raw {
+		data, _ := json.Marshal(result)
+		fmt.Println(string(data))
+	} else {
+		fmt.Println(result.text())
+	}
+	if result.IsError {
+		return 1
+	}
+	return 0
+}
+
+// callAttached runs the call in a running session through its control socket
+func callAttached(socket, tool string, arguments map[string]interface{}, timeout time.Duration) (*toolResult, error) {
+	path, err := findControlSocket(socket)
+	if err != nil {
+		return nil, err
+	}
+	data, err := controlCallTimeout(path, &controlRequest{Command: "call", Tool: tool, Arguments: arguments}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseToolResult(data), nil
+}
+
+// callInSession starts the wrapper as an MCP server, initializes it, makes the call and
+// ends the session, so the call passes through everything a client's call would
+func callInSession(playwrightArgs []string, tool string, arguments map[string]interface{}, timeout time.Duration) (*toolResult, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, playwrightArgs...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	responses := make(chan *rpcMessage)
+	go func() {
+		defer close(responses)
+		lr := newLineReader(stdout)
+		for {
+			line, err := lr.Next()
+			if err != nil {
+				return
+			}
+			msg := &rpcMessage{}
+			if json.Unmarshal(line, msg) == nil && msg.ID != nil && msg.Method == "" {
+				responses <- msg
+			}
+		}
+	}()
+	deadline := time.After(timeout)
+	writer := &lineWriter{w: stdin}
+	request := func(id int, method string, params interface{}) (*rpcMessage, error) {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		line, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(fmt.Sprint(id)), Method: method, Params: encoded})
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.Write(line); err != nil {
+			return nil, err
+		}
+		for {
+			select {
+			case msg, ok := <-responses:
+				if !ok {
+					return nil, fmt.Errorf("the session ended before answering %s", method)
+				}
+				if string(msg.ID) != fmt.Sprint(id) {
+					continue
+				}
+				if msg.Error != nil {
+					return nil, fmt.Errorf("%s failed: %s", method, msg.Error.Message)
+				}
+				return msg, nil
+			case <-deadline:
+				cmd.Process.Signal(os.Interrupt)
+				return nil, fmt.Errorf("no answer to %s within %v", method, timeout)
+			}
+		}
+	}
+
+	initialize := map[string]interface{}{
+		"protocolVersion": callProtocol,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "playwrightwrap-call", "version": "1"},
+	}
+	if _, err := request(1, "initialize", initialize); err != nil {
+		return nil, err
+	}
+	if err := writer.Write([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		return nil, err
+	}
+	response, err := request(2, "tools/call", toolCall{Name: tool, Arguments: arguments})
+	if err != nil {
+		return nil, err
+	}
+	return parseToolResult(response.Result), nil
+}
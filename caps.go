@@ -0,0 +1,35 @@
+package main
+
+import "strings"
+
+// knownCaps are the capabilities @playwright/mcp accepted for --caps when the wrapper was
+// built. Newer versions add more, so others are passed on with a warning.
+var knownCaps = []string{"core", "tabs", "pdf", "history", "wait", "files", "install", "vision", "verify", "tracing"}
+
+// capsFlag returns the configured capabilities as a --caps value, along with those
+// not in knownCaps
+func capsFlag(caps []string) (string, []string) {
+	seen := map[string]bool{}
+	var values, unknown []string
+	for _, c := range caps {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		values = append(values, c)
+		if !isKnownCap(c) {
+			unknown = append(unknown, c)
+		}
+	}
+	return strings.Join(values, ","), unknown
+}
+
+func isKnownCap(c string) bool {
+	for _, known := range knownCaps {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// storageStateCode reads the browser context's storage state through browser_run_code
+	storageStateCode  = "async (page) => JSON.stringify(await page.context().storageState())"
+	checkpointTimeout = 30 * time.Second
+
+	strategyMerge   = "merge"
+	strategyReplace = "replace"
+)
+
+// Checkpointer saves the live browser state back to the temp copy and the profile
+type Checkpointer struct {
+	proxy       *Proxy
+	logger      *Logger
+	tempPath    string
+	profilePath string
+	strategy    string
+	interval    time.Duration
+	// events receives a state_saved event per checkpoint, nil when nobody listens
+	events eventSink
+	// profile and sessionID identify the writer in the registry
+	profile    string
+	sessionID  string
+	onConflict string
+	// baseline is the checksum of the profile's state when this session last read or wrote it
+	baseline string
+	// layers are the profile's merged lower layers, left out of write-backs; nil without layers
+	layers *StorageState
+
+	mu    sync.Mutex
+	count int
+	last  time.Time
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewCheckpointer validates the checkpoint config and creates a checkpointer
+func NewCheckpointer(config *CheckpointConfig, proxy *Proxy, logger *Logger, tempPath string, profilePath string) (*Checkpointer, error) {
+	strategy := config.Strategy
+	if strategy == "" {
+		strategy = strategyMerge
+	}
+	if strategy != strategyMerge && strategy != strategyReplace {
+		return nil, fmt.Errorf("unknown checkpoint strategy %q, expected %s or %s", strategy, strategyMerge, strategyReplace)
+	}
+	onConflict := config.OnConflict
+	if onConflict == "" {
+		onConflict = conflictMerge
+	}
+	if onConflict != conflictMerge && onConflict != conflictAbort {
+		return nil, fmt.Errorf("unknown checkpoint onConflict %q, expected %s or %s", onConflict, conflictMerge, conflictAbort)
+	}
+	return &Checkpointer{
+		onConflict:  onConflict,
+		proxy:       proxy,
+		logger:      logger,
+		tempPath:    tempPath,
+		profilePath: profilePath,
+		strategy:    strategy,
+		interval:    time.Duration(config.Interval),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Start saves a checkpoint every interval once the session is initialized, until Stop
+func (c *Checkpointer) Start() {
+	go func() {
+		defer close(c.done)
+		if c.interval <= 0 {
+			return
+		}
+		select {
+		case <-c.proxy.Ready():
+		case <-c.stop:
+			return
+		}
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				if err := c.Save("interval"); err != nil {
+					c.logger.Log("State checkpoint failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends periodic checkpoints
+func (c *Checkpointer) Stop() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	<-c.done
+}
+
+// Save fetches the live storage state, writes it to the temp copy and writes it back to
+// the profile according to the strategy
+func (c *Checkpointer) Save(reason string) error {
+	select {
+	case <-c.proxy.Ready():
+	default:
+		return errors.New("the session is not initialized yet")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.proxy.lease.Expired() {
+		return errors.New("the session's credential lease expired")
+	}
+
+	state, err := fetchStorageState(c.proxy)
+	if err != nil {
+		return err
+	}
+	if err := state.save(c.tempPath); err != nil {
+		return fmt.Errorf("failed to update temp copy: %v", err)
+	}
+
+	if c.layers != nil {
+		state = topLayer(state, c.layers)
+	}
+	if err := c.writeBack(state); err != nil {
+		return err
+	}
+	c.count++
+	c.last = clockNow()
+	c.logger.Log("State checkpoint (%s) saved to %s with %d cookies", reason, c.profilePath, len(state.Cookies))
+	if c.events != nil {
+		c.events.Publish(eventStateSaved, map[string]interface{}{"reason": reason, "path": c.profilePath, "cookies": len(state.Cookies)})
+	}
+	return nil
+}
+
+// Stats returns how many checkpoints were saved and when the last one was
+func (c *Checkpointer) Stats() (int, time.Time) {
+	if c == nil {
+		return 0, time.Time{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count, c.last
+}
+
+// fetchStorageState asks the child for the browser context's current storage state
+func fetchStorageState(proxy *Proxy) (*StorageState, error) {
+	result, err := proxy.CallTool("browser_run_code", map[string]interface{}{"code": storageStateCode}, checkpointTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseStorageStateResult(result.text())
+}
+
+// parseStorageStateResult finds the storage state in a browser_run_code result, which
+// shows the returned value either as a JSON string or as the bare document
+func parseStorageStateResult(text string) (*StorageState, error) {
+	for _, marker := range []string{`"{\"cookies\"`, `{"cookies"`} {
+		start := strings.Index(text, marker)
+		if start < 0 {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text[start:]))
+		state := &StorageState{}
+		if marker[0] == '"' {
+			var encoded string
+			if decoder.Decode(&encoded) == nil && json.Unmarshal([]byte(encoded), state) == nil {
+				return state, nil
+			}
+		} else if decoder.Decode(state) == nil {
+			return state, nil
+		}
+	}
+	return nil, errors.New("no storage state found in the browser_run_code result")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const stderrTailSize = 64 * 1024
+
+// ChildConfig sets up the process the child runs in, which otherwise inherits the
+// directory and umask of whatever launched the wrapper
+type ChildConfig struct {
+	// WorkDir is the child's working directory, against which @playwright/mcp resolves
+	// relative output paths; created when missing
+	WorkDir string `json:"workDir,omitempty"`
+	// Umask is the octal umask the child creates its files with, such as "077". Not
+	// supported on Windows.
+	Umask string `json:"umask,omitempty"`
+}
+
+// childSettings is a resolved ChildConfig
+type childSettings struct {
+	dir string
+	// umask is -1 to keep the wrapper's
+	umask int
+}
+
+// childSettings merges the top-level child config with the profile's, which wins
+func (c *Config) childSettings(profile string) (*childSettings, error) {
+	config := ChildConfig{}
+	for _, layer := range []*ChildConfig{c.Child, c.Profile(profile).Child} {
+		if layer == nil {
+			continue
+		}
+		if layer.WorkDir != "" {
+			config.WorkDir = layer.WorkDir
+		}
+		if layer.Umask != "" {
+			config.Umask = layer.Umask
+		}
+	}
+	settings := &childSettings{umask: -1}
+	if config.WorkDir != "" {
+		dir, err := filepath.Abs(config.WorkDir)
+		if err != nil {
+			return nil, err
+		}
+		settings.dir = dir
+	}
+	if config.Umask != "" {
+		mask, err := strconv.ParseUint(config.Umask, 8, 32)
+		if err != nil || mask > 0777 {
+			return nil, fmt.Errorf("invalid child umask %q, expected an octal value such as 077", config.Umask)
+		}
+		settings.umask = int(mask)
+	}
+	return settings, nil
+}
+
+// childProcess is one run of the playwright child
+type childProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// startChild launches npx with the given arguments, environment and settings, teeing
+// its stderr to the wrapper's. The prompt watcher sees stderr until the child first
+// writes to stdout.
+func startChild(npxArgs []string, env []string, settings *childSettings, tail *stderrTail, prompts *promptWatcher) (*childProcess, error) {
+	cmd := exec.Command("npx", npxArgs...)
+	cmd.Env = env
+	if settings == nil {
+		settings = &childSettings{umask: -1}
+	}
+	if settings.dir != "" {
+		if err := os.MkdirAll(settings.dir, 0700); err != nil {
+			return nil, err
+		}
+		cmd.Dir = settings.dir
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail, prompts)
+	prompts.attach(cmd)
+	start := cmd.Start
+	if settings.umask >= 0 {
+		start = func() error { return startWithUmask(cmd, settings.umask) }
+	}
+	if err := start(); err != nil {
+		return nil, err
+	}
+	return &childProcess{cmd: cmd, stdin: stdin, stdout: &disarmReader{ReadCloser: stdout, prompts: prompts}}, nil
+}
+
+// stderrTail keeps the last bytes the child wrote to stderr
+type stderrTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailSize {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-stderrTailSize:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the collected output
+func (t *stderrTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// Reset drops the collected output
+func (t *stderrTail) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = nil
+}
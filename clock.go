@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deterministicEpoch is the time the clock stands at in deterministic mode
+var deterministicEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Clock tells the time written to logs, recordings, status files and reports. Timeouts
+// and pacing keep using the real time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// frozenClock always tells the same time
+type frozenClock struct {
+	at time.Time
+}
+
+func (c frozenClock) Now() time.Time {
+	return c.at
+}
+
+// wrapClock is the wrapper's clock; tests may replace it
+var wrapClock Clock = systemClock{}
+
+func clockNow() time.Time {
+	return wrapClock.Now()
+}
+
+func clockSince(t time.Time) time.Duration {
+	return wrapClock.Now().Sub(t)
+}
+
+// deterministic reports whether the wrapper runs in deterministic mode, set with the
+// hidden --wrap-deterministic flag or PLAYWRIGHTWRAP_DETERMINISTIC. It freezes the clock
+// and gives sessions and temp files fixed names, so that golden-file tests of the
+// wrapper's output are stable.
+func deterministic() bool {
+	return os.Getenv("PLAYWRIGHTWRAP_DETERMINISTIC") != ""
+}
+
+// applyDeterministicMode freezes the clock when deterministic mode is on
+func applyDeterministicMode() {
+	if deterministic() {
+		wrapClock = frozenClock{at: deterministicEpoch}
+	}
+}
+
+// mkdirTemp is os.MkdirTemp; in deterministic mode the random part of the name is a
+// sequence number, the first one free
+func mkdirTemp(dir, pattern string) (string, error) {
+	if !deterministic() {
+		return os.MkdirTemp(dir, pattern)
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	for i := 1; ; i++ {
+		path := filepath.Join(dir, strings.Replace(pattern, "*", fmt.Sprint(i), 1))
+		err := os.Mkdir(path, 0700)
+		if !os.IsExist(err) {
+			return path, err
+		}
+	}
+}
+
+// createTemp is os.CreateTemp with the naming of mkdirTemp
+func createTemp(dir, pattern string) (*os.File, error) {
+	if !deterministic() {
+		return os.CreateTemp(dir, pattern)
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	for i := 1; ; i++ {
+		path := filepath.Join(dir, strings.Replace(pattern, "*", fmt.Sprint(i), 1))
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+// commands maps subcommand names to their implementations. Arguments that do not start
+// with a known subcommand are passed on to playwright.
+var commands = map[string]func(args []string) int{
+	"approve":   runApprove,
+	"cache":     runCache,
+	"call":      runCall,
+	"connect":   runConnect,
+	"deny":      runDeny,
+	"events":    runEvents,
+	"export":    runExport,
+	"import":    runImport,
+	"migrate":   runMigrate,
+	"policy":    runPolicy,
+	"profiles":  runProfiles,
+	"redaction": runRedaction,
+	"reload":    runReload,
+	"report":    runReport,
+	"rerun":     runRerun,
+	"rotation":  runRotation,
+	"run-all":   runRunAll,
+	"setup":     runSetup,
+	"top":       runTop,
+	"trace":     runTrace,
+	"warm":      runWarm,
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	compressionGzip = "gzip"
+	gzipSuffix      = ".gz"
+)
+
+// validateCompression checks the configured compression of logs and recordings
+func validateCompression(compression string) error {
+	switch compression {
+	case "", compressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression %q, only %s is available", compression, compressionGzip)
+	}
+}
+
+// compressedPath adds the .gz suffix to path when compression is enabled
+func compressedPath(path, compression string) string {
+	if compression == compressionGzip && !strings.HasSuffix(path, gzipSuffix) {
+		return path + gzipSuffix
+	}
+	return path
+}
+
+// flushWriter is a gzip stream that is flushed after every write, so an artifact stays
+// readable up to its last line if the wrapper is killed
+type flushWriter struct {
+	gz *gzip.Writer
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.gz.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, w.gz.Flush()
+}
+
+// Close ends the gzip stream without closing the underlying file
+func (w *flushWriter) Close() error {
+	return w.gz.Close()
+}
+
+// newArtifactWriter returns a writer for file, compressing when path ends in .gz
+func newArtifactWriter(file *os.File, path string) io.WriteCloser {
+	if strings.HasSuffix(path, gzipSuffix) {
+		return &flushWriter{gz: gzip.NewWriter(file)}
+	}
+	return nopCloser{file}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// openArtifact opens a log or recording, decompressing it if it is gzipped whatever
+// its name
+func openArtifact(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &artifactReader{Reader: gz, file: file}, nil
+	}
+	return &artifactReader{Reader: buffered, file: file}, nil
+}
+
+type artifactReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *artifactReader) Close() error {
+	return r.file.Close()
+}
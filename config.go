@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultProfileName = "default"
+	storageStateFile   = "storage_state.json"
+	mcpPackage         = "@playwright/mcp"
+)
+
+// Config is the wrapper configuration file
+type Config struct {
+	Profiles map[string]*ProfileConfig `json:"profiles,omitempty"`
+	// Rotations are named sets of profiles that sessions are spread across
+	Rotations map[string]*RotationConfig `json:"rotations,omitempty"`
+	// Environment applies to every session and to warm
+	Environment *EnvironmentConfig `json:"environment,omitempty"`
+	// WatchConfig reloads the session's policies and throttle when this file changes
+	WatchConfig bool `json:"watchConfig,omitempty"`
+	// KeepSessions moves each session's directory, with its log and status file, to the
+	// archive instead of removing it; the storage state copy is deleted either way
+	KeepSessions bool `json:"keepSessions,omitempty"`
+	// NpxInstall is "yes" (the default) to let npx install a missing @playwright/mcp without
+	// asking, or "no" to fail instead
+	NpxInstall string `json:"npxInstall,omitempty"`
+	// MCPVersion pins the @playwright/mcp version sessions, warm and trace use; the
+	// latest by default
+	MCPVersion string `json:"mcpVersion,omitempty"`
+	// CrashLoop quarantines profiles whose child keeps crashing
+	CrashLoop *CrashLoopConfig `json:"crashLoop,omitempty"`
+	// LogFallback is where the session log goes when its file cannot be created or
+	// written: "stderr" (the default) or "none" to drop it. Either way a warning is printed.
+	LogFallback string `json:"logFallback,omitempty"`
+	// Compression is "gzip" to compress session logs and recordings as they are written
+	Compression string `json:"compression,omitempty"`
+	// Redactions are named rule sets that profiles select to hide sensitive values
+	Redactions map[string]*RedactionConfig `json:"redactions,omitempty"`
+	// Notifications send session events to Slack, email or the desktop
+	Notifications *NotificationsConfig `json:"notifications,omitempty"`
+	// Metrics pushes each session's metrics when it ends
+	Metrics *MetricsConfig `json:"metrics,omitempty"`
+	// Child sets the working directory and umask of every session's child
+	Child *ChildConfig `json:"child,omitempty"`
+}
+
+// RotationConfig picks one profile per session from a set of profiles
+type RotationConfig struct {
+	Profiles []string `json:"profiles"`
+	// Policy is "round-robin" (the default), "least-recently-used" or "least-utilized",
+	// which picks the profile that used the smallest share of its quota
+	Policy string `json:"policy,omitempty"`
+	// Cooldown is the minimum time before a profile is handed out again
+	Cooldown Duration `json:"cooldown,omitempty"`
+	// Quota caps each profile's use; profiles that used it up are skipped and sessions
+	// are held to what is left
+	Quota *QuotaConfig `json:"quota,omitempty"`
+}
+
+// ProfileConfig holds the settings of one named profile
+type ProfileConfig struct {
+	// StorageState overrides the location of the profile's storage state file
+	StorageState string `json:"storageState,omitempty"`
+	// Layers are profiles whose storage states are merged under this profile's own, the
+	// first at the bottom. They are read-only to the session: write-backs only go to this
+	// profile's state and only with what differs from the layers.
+	Layers []string `json:"layers,omitempty"`
+	// Template expands ${ENV_VAR} placeholders in the storage state into the session copy
+	Template bool `json:"template,omitempty"`
+	// PruneExpired drops expired cookies and empty origins from the session copy
+	PruneExpired bool `json:"pruneExpired,omitempty"`
+	// Browser is passed to the child as --browser, such as chrome, firefox, webkit or msedge
+	Browser string `json:"browser,omitempty"`
+	// ExecutablePath runs this browser binary instead of a downloaded build, passed to
+	// the child as --executable-path
+	ExecutablePath string `json:"executablePath,omitempty"`
+	// Caps is the capability set passed to the child as --caps, replacing the client's
+	Caps []string `json:"caps,omitempty"`
+	// ToolPrefix is prepended to the name of every tool the client sees, such as "pw_"
+	ToolPrefix string `json:"toolPrefix,omitempty"`
+	// ToolRenames gives tools other names for the client, keyed by the child's name;
+	// renamed tools get no prefix
+	ToolRenames map[string]string `json:"toolRenames,omitempty"`
+	// ValidateArguments rejects tool calls whose arguments do not match the schemas the
+	// child advertised, before they reach the browser
+	ValidateArguments bool `json:"validateArguments,omitempty"`
+	// Policy restricts which tools the client may call
+	Policy *PolicyConfig `json:"policy,omitempty"`
+	// Approval holds sensitive tool calls until they are approved on the control socket
+	Approval *ApprovalConfig `json:"approval,omitempty"`
+	// Cache answers repeated identical read-only calls without asking the browser
+	Cache *CacheConfig `json:"cache,omitempty"`
+	// Budget caps the tool calls and navigations of each session
+	Budget *BudgetConfig `json:"budget,omitempty"`
+	// Tools overrides settings for single tools, keyed by the child's tool name or a
+	// pattern such as "browser_tab_*"; the most specific entry setting a value wins
+	Tools map[string]*ToolConfig `json:"tools,omitempty"`
+	// Redaction names the redaction sets applied to this profile's logs, recordings and
+	// responses, from redactions or the built-in "credentials" set
+	Redaction []string `json:"redaction,omitempty"`
+	// Network restricts the origins the browser may reach
+	Network *NetworkConfig `json:"network,omitempty"`
+	// Throttle paces navigations per host
+	Throttle *ThrottleConfig `json:"throttle,omitempty"`
+	// Downloads manages the files the session writes to the child's output directory
+	Downloads *DownloadsConfig `json:"downloads,omitempty"`
+	// AuthSignals mark the session state dirty when a login or refresh is observed
+	AuthSignals *AuthSignalsConfig `json:"authSignals,omitempty"`
+	// Checkpoint periodically saves the live browser state back to the profile
+	Checkpoint *CheckpointConfig `json:"checkpoint,omitempty"`
+	// Lease limits how long a session holds the profile's credentials
+	Lease *LeaseConfig `json:"lease,omitempty"`
+	// ErrorCapture saves a screenshot of the page whenever a tool call fails
+	ErrorCapture *ErrorCaptureConfig `json:"errorCapture,omitempty"`
+	// Probe checks that the profile is still signed in before the session starts
+	Probe *ProbeConfig `json:"probe,omitempty"`
+	// History exports the pages each session visited when it ends
+	History *HistoryConfig `json:"history,omitempty"`
+	// Environment adds to and overrides the top-level environment for this profile
+	Environment *EnvironmentConfig `json:"environment,omitempty"`
+	// Child overrides the top-level child working directory and umask
+	Child *ChildConfig `json:"child,omitempty"`
+}
+
+// CheckpointConfig controls writing the session's state back to the profile
+type CheckpointConfig struct {
+	// Interval between checkpoints; when zero the state is only saved as the session ends
+	Interval Duration `json:"interval,omitempty"`
+	// Strategy is "merge" (the default) to merge into the profile or "replace" to overwrite it
+	Strategy string `json:"strategy,omitempty"`
+	// OnConflict is "merge" (the default) to merge into a profile another session changed
+	// meanwhile, even with the replace strategy, or "abort" to skip the write-back
+	OnConflict string `json:"onConflict,omitempty"`
+}
+
+// AuthSignalsConfig lists what indicates that credentials changed during a session
+type AuthSignalsConfig struct {
+	// URLs are regular expressions matched against navigation targets, such as login endpoints
+	URLs []string `json:"urls,omitempty"`
+	// Results are regular expressions matched against the text of successful tool
+	// results, by default one matching Set-Cookie
+	Results []string `json:"results,omitempty"`
+}
+
+// DownloadsConfig sets the managed output directory and which files may stay in it
+type DownloadsConfig struct {
+	// Dir is passed to the child as --output-dir, ./output by default
+	Dir string `json:"dir,omitempty"`
+	// AllowedExtensions lists file extensions to keep, such as "pdf" or ".csv"
+	AllowedExtensions []string `json:"allowedExtensions,omitempty"`
+	// AllowedTypes lists MIME types to keep; "image/*" matches a whole family
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+}
+
+// ThrottleConfig sets the minimum interval between navigations to the same host
+type ThrottleConfig struct {
+	// Interval applies to every host without an entry in Hosts
+	Interval Duration `json:"interval,omitempty"`
+	// Hosts sets per-host intervals, keyed by host name; a key also covers its subdomains
+	Hosts map[string]Duration `json:"hosts,omitempty"`
+}
+
+// Duration is a time.Duration read from JSON strings such as "1.5s"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// configPath returns the config file location, overridable with PLAYWRIGHTWRAP_CONFIG
+func configPath() string {
+	if path := os.Getenv("PLAYWRIGHTWRAP_CONFIG"); path != "" {
+		return path
+	}
+	return defaultConfigPath()
+}
+
+// profileName returns the selected profile, overridable with PLAYWRIGHTWRAP_PROFILE
+func profileName() string {
+	if name := os.Getenv("PLAYWRIGHTWRAP_PROFILE"); name != "" {
+		return name
+	}
+	return defaultProfileName
+}
+
+// LoadConfig reads the config file. A missing file yields an empty config.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// save writes the config file, creating its directory. It is readable by the owner only,
+// it holds webhook URLs and environment values.
+func (c *Config) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// mcpPackageSpec returns the package npx runs, pinned to MCPVersion if set
+func (c *Config) mcpPackageSpec() string {
+	if c.MCPVersion != "" {
+		return mcpPackage + "@" + c.MCPVersion
+	}
+	return mcpPackage
+}
+
+// Profile returns the settings of the named profile, empty if it is not configured
+func (c *Config) Profile(name string) *ProfileConfig {
+	if profile, ok := c.Profiles[name]; ok && profile != nil {
+		return profile
+	}
+	return &ProfileConfig{}
+}
+
+// privilegedSettings returns the settings that choose what runs for the session, where
+// its credentials and files go or what it is allowed to do: the browser executable, the
+// environment, the child process, the probe page, the layers, the downloads, error capture
+// and history directories, the tool policy, the tools map, approvals and the network
+// restrictions. They are not taken from someone else's config without review.
+func (p *ProfileConfig) privilegedSettings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	add := func(name string, value interface{}, set bool) {
+		if set {
+			settings[name] = value
+		}
+	}
+	add("executablePath", p.ExecutablePath, p.ExecutablePath != "")
+	add("environment", p.Environment, p.Environment != nil)
+	add("child", p.Child, p.Child != nil)
+	add("probe", p.Probe, p.Probe != nil)
+	add("layers", p.Layers, len(p.Layers) > 0)
+	add("downloads", p.Downloads, p.Downloads != nil)
+	add("errorCapture", p.ErrorCapture, p.ErrorCapture != nil)
+	add("history", p.History, p.History != nil)
+	add("policy", p.Policy, p.Policy != nil)
+	add("tools", p.Tools, len(p.Tools) > 0)
+	add("approval", p.Approval, p.Approval != nil)
+	add("network", p.Network, p.Network != nil)
+	return settings
+}
+
+// dropPrivilegedSettings clears the settings privilegedSettings reports
+func (p *ProfileConfig) dropPrivilegedSettings() {
+	p.keepPrivilegedSettings(&ProfileConfig{})
+}
+
+// keepPrivilegedSettings copies the privileged settings of from
+func (p *ProfileConfig) keepPrivilegedSettings(from *ProfileConfig) {
+	p.ExecutablePath, p.Environment, p.Child, p.Probe = from.ExecutablePath, from.Environment, from.Child, from.Probe
+	p.Layers, p.Downloads, p.ErrorCapture, p.History = from.Layers, from.Downloads, from.ErrorCapture, from.History
+	p.Policy, p.Tools, p.Approval, p.Network = from.Policy, from.Tools, from.Approval, from.Network
+}
+
+// storageStatePath returns where the named profile keeps its storage state
+func (c *Config) storageStatePath(name string) string {
+	if path := c.Profile(name).StorageState; path != "" {
+		return path
+	}
+	if name == defaultProfileName {
+		return filepath.Join(profilesDir(), storageStateFile)
+	}
+	return filepath.Join(profilesDir(), name, storageStateFile)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const controlTimeout = 10 * time.Second
+
+// controlRequest is one command sent to a session's control socket
+type controlRequest struct {
+	Command string `json:"command"`
+	ID      string `json:"id,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	// Tool and Arguments are the tool call of the call command
+	Tool      string                 `json:"tool,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// controlResponse answers a control command
+type controlResponse struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// controlHandler implements one control command
+type controlHandler func(request *controlRequest) (interface{}, error)
+
+// ControlServer lets other processes talk to a running session over a unix socket, one
+// JSON request and response per line
+type ControlServer struct {
+	logger   *Logger
+	path     string
+	listener net.Listener
+
+	mu          sync.Mutex
+	handlers    map[string]controlHandler
+	subscribers map[*lineWriter]net.Conn
+}
+
+// Lifecycle events published to subscribers of the control socket
+const (
+	eventChildStarted = "child_started"
+	eventHandshakeOK  = "handshake_ok"
+	eventRestart      = "restart"
+	eventStateSaved   = "state_saved"
+	eventShuttingDown = "shutting_down"
+)
+
+// controlEvent is one line sent to subscribers
+type controlEvent struct {
+	Event  string                 `json:"event"`
+	Time   time.Time              `json:"time"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// NewControlServer listens on path, readable by the owner only
+func NewControlServer(path string, logger *Logger) (*ControlServer, error) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &ControlServer{
+		logger:      logger,
+		path:        path,
+		listener:    listener,
+		handlers:    make(map[string]controlHandler),
+		subscribers: make(map[*lineWriter]net.Conn),
+	}, nil
+}
+
+// Path returns the socket location
+func (s *ControlServer) Path() string {
+	return s.path
+}
+
+// Handle registers the handler of a command
+func (s *ControlServer) Handle(command string, handler controlHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[command] = handler
+}
+
+// Start accepts connections in the background until Close
+func (s *ControlServer) Start() {
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *ControlServer) serve(conn net.Conn) {
+	defer conn.Close()
+	writer := &lineWriter{w: conn}
+	lr := newLineReader(conn)
+	for {
+		line, err := lr.Next()
+		if err != nil {
+			return
+		}
+		if s.subscribe(conn, writer, line) {
+			// Events flow until the subscriber hangs up
+			lr.Next()
+			s.unsubscribe(writer)
+			return
+		}
+		response := s.dispatch(line)
+		data, err := json.Marshal(response)
+		if err != nil {
+			return
+		}
+		if err := writer.Write(data); err != nil {
+			return
+		}
+	}
+}
+
+func (s *ControlServer) dispatch(line []byte) *controlResponse {
+	var request controlRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return &controlResponse{Error: "invalid request: " + err.Error()}
+	}
+	s.mu.Lock()
+	handler, ok := s.handlers[request.Command]
+	s.mu.Unlock()
+	if !ok {
+		return &controlResponse{Error: fmt.Sprintf("unknown command %q", request.Command)}
+	}
+	s.logger.Log("Control command: %s %s", request.Command, request.ID)
+	result, err := handler(&request)
+	if err != nil {
+		return &controlResponse{Error: err.Error()}
+	}
+	response := &controlResponse{OK: true}
+	if result != nil {
+		if response.Result, err = json.Marshal(result); err != nil {
+			return &controlResponse{Error: err.Error()}
+		}
+	}
+	return response
+}
+
+// subscribe turns the connection into an event stream if the request asks for it
+func (s *ControlServer) subscribe(conn net.Conn, writer *lineWriter, line []byte) bool {
+	var request controlRequest
+	if json.Unmarshal(line, &request) != nil || request.Command != "subscribe" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, _ := json.Marshal(&controlResponse{OK: true})
+	if writer.Write(data) != nil {
+		return false
+	}
+	s.subscribers[writer] = conn
+	s.logger.Log("Control subscriber connected")
+	return true
+}
+
+func (s *ControlServer) unsubscribe(writer *lineWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, writer)
+}
+
+// Publish sends an event to every subscriber; subscribers that cannot keep up are
+// dropped. A nil server publishes nothing.
+func (s *ControlServer) Publish(event string, fields map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(controlEvent{Event: event, Time: clockNow(), Fields: fields})
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for writer, conn := range s.subscribers {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if err := writer.Write(data); err != nil {
+			s.logger.Log("Dropping control subscriber: %v", err)
+			conn.Close()
+			delete(s.subscribers, writer)
+		}
+	}
+}
+
+// Close stops accepting connections and removes the socket. A nil server does nothing.
+func (s *ControlServer) Close() {
+	if s == nil {
+		return
+	}
+	s.listener.Close()
+	os.Remove(s.path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for writer, conn := range s.subscribers {
+		conn.Close()
+		delete(s.subscribers, writer)
+	}
+}
+
+// findControlSocket returns the socket to talk to: the given one, PLAYWRIGHTWRAP_CONTROL,
+// or the only running session's
+func findControlSocket(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if path := os.Getenv("PLAYWRIGHTWRAP_CONTROL"); path != "" {
+		return path, nil
+	}
+	sockets, _ := filepath.Glob(filepath.Join(sessionTmpDir(), sessionsDir, "*", sessionSocketFile))
+	switch len(sockets) {
+	case 0:
+		return "", fmt.Errorf("no running session found in %s", sessionTmpDir())
+	case 1:
+		return sockets[0], nil
+	default:
+		return "", fmt.Errorf("several sessions are running, choose one with --socket: %v", sockets)
+	}
+}
+
+// controlCall sends one command to a session's control socket and returns its result
+func controlCall(path string, request *controlRequest) (json.RawMessage, error) {
+	return controlCallTimeout(path, request, controlTimeout)
+}
+
+// controlCallTimeout is controlCall with a custom timeout
+func controlCallTimeout(path string, request *controlRequest, timeout time.Duration) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := (&lineWriter{w: conn}).Write(data); err != nil {
+		return nil, err
+	}
+	line, err := newLineReader(conn).Next()
+	if err != nil {
+		return nil, err
+	}
+	var response controlResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return nil, err
+	}
+	if !response.OK {
+		return nil, errors.New(response.Error)
+	}
+	return response.Result, nil
+}
+
+// runEvents implements "playwrightwrap events", printing a session's lifecycle events
+// as JSON lines until it ends
+func runEvents(args []string) int {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket of the session, found automatically when only one is running")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	path, err := findControlSocket(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		return 1
+	}
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to %s: %v\n", path, err)
+		return 1
+	}
+	defer conn.Close()
+	data, _ := json.Marshal(&controlRequest{Command: "subscribe"})
+	if err := (&lineWriter{w: conn}).Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to subscribe: %v\n", err)
+		return 1
+	}
+	lr := newLineReader(conn)
+	if _, err := lr.Next(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to subscribe: %v\n", err)
+		return 1
+	}
+	for {
+		line, err := lr.Next()
+		if err != nil {
+			return 0
+		}
+		fmt.Println(string(line))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const httpOnlyPrefix = "#HttpOnly_"
+
+// writeNetscapeJar writes cookies in the Netscape cookies.txt format understood by curl and wget
+func writeNetscapeJar(w io.Writer, cookies []Cookie) error {
+	if _, err := fmt.Fprintln(w, "# Netscape HTTP Cookie File"); err != nil {
+		return err
+	}
+	for _, c := range cookies {
+		domain := c.Domain
+		if c.HTTPOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		expires := int64(0)
+		if c.Expires > 0 {
+			expires = int64(c.Expires)
+		}
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(strings.HasPrefix(c.Domain, ".")), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// curlCookieHeader renders cookies as a value for curl -b
+func curlCookieHeader(cookies []Cookie) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+func netscapeBool(value bool) string {
+	return strings.ToUpper(strconv.FormatBool(value))
+}
+
+// parseNetscapeJar reads a Netscape cookies.txt file
+func parseNetscapeJar(r io.Reader) ([]Cookie, error) {
+	var cookies []Cookie
+	lr := newLineReader(r)
+	for n := 1; ; n++ {
+		line, err := lr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Only the line ending is cut, a cookie with an empty value ends in a tab
+		text := strings.TrimRight(string(line), "\r\n")
+		trimmed := strings.TrimSpace(text)
+		httpOnly := false
+		if strings.HasPrefix(trimmed, httpOnlyPrefix) {
+			httpOnly = true
+			text = strings.TrimPrefix(strings.TrimLeft(text, " \t"), httpOnlyPrefix)
+		} else if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("line %d: expected 7 tab separated fields, got %d", n, len(fields))
+		}
+		expires, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry %q", n, fields[4])
+		}
+		if expires <= 0 {
+			expires = -1
+		}
+		cookies = append(cookies, Cookie{
+			Name:     fields[5],
+			Value:    strings.Join(fields[6:], "\t"),
+			Domain:   fields[0],
+			Path:     fields[2],
+			Expires:  expires,
+			HTTPOnly: httpOnly,
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			SameSite: "Lax",
+		})
+	}
+	return cookies, nil
+}
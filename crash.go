@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const (
+	defaultMaxCrashes  = 5
+	defaultCrashWindow = 5 * time.Minute
+	crashesDir         = "crashes"
+)
+
+// CrashLoopConfig decides when a profile whose child keeps crashing is quarantined
+type CrashLoopConfig struct {
+	// MaxCrashes within Window quarantine the profile, 5 by default
+	MaxCrashes int `json:"maxCrashes,omitempty"`
+	// Window is how far back crashes are counted, 5m by default
+	Window Duration `json:"window,omitempty"`
+}
+
+// limits returns the crash count and window, applying the defaults
+func (c *CrashLoopConfig) limits() (int, time.Duration) {
+	max, window := defaultMaxCrashes, defaultCrashWindow
+	if c != nil && c.MaxCrashes > 0 {
+		max = c.MaxCrashes
+	}
+	if c != nil && c.Window > 0 {
+		window = time.Duration(c.Window)
+	}
+	return max, window
+}
+
+// Quarantine marks a profile that is not started again until released
+type Quarantine struct {
+	Since   time.Time `json:"since"`
+	Crashes int       `json:"crashes"`
+	Bundle  string    `json:"bundle,omitempty"`
+}
+
+// crashReport is what the crash bundle records about the environment, the things one
+// would check first by hand
+type crashReport struct {
+	Profile     string      `json:"profile"`
+	Time        time.Time   `json:"time"`
+	ExitCode    int         `json:"exitCode"`
+	Crashes     []time.Time `json:"crashes"`
+	Args        []string    `json:"args"`
+	Environment []string    `json:"environment,omitempty"`
+	NodePath    string      `json:"nodePath,omitempty"`
+	NodeVersion string      `json:"nodeVersion,omitempty"`
+	NodeError   string      `json:"nodeError,omitempty"`
+	NpxPath     string      `json:"npxPath,omitempty"`
+	OS          string      `json:"os"`
+	Wrapper     string      `json:"wrapper"`
+}
+
+// recordCrash adds a crash of the profile's child to the registry. When the profile has
+// crashed too often within the window it is quarantined and a crash bundle is written
+// with the report, the child's stderr and the session log.
+func recordCrash(config *CrashLoopConfig, report *crashReport, stderr string, logPath string) (*Quarantine, error) {
+	max, window := config.limits()
+	var quarantine *Quarantine
+	err := updateRegistry(func(registry *Registry) error {
+		record := registry.profile(report.Profile)
+		var recent []time.Time
+		for _, crash := range record.Crashes {
+			if report.Time.Sub(crash) < window {
+				recent = append(recent, crash)
+			}
+		}
+		record.Crashes = append(recent, report.Time)
+		if len(record.Crashes) < max {
+			return nil
+		}
+		report.Crashes = record.Crashes
+		bundle, err := writeCrashBundle(report, stderr, logPath)
+		if err != nil {
+			return err
+		}
+		quarantine = &Quarantine{Since: report.Time, Crashes: len(record.Crashes), Bundle: bundle}
+		record.Quarantined = quarantine
+		return nil
+	})
+	return quarantine, err
+}
+
+// writeCrashBundle writes the crash bundle directory and returns its path
+func writeCrashBundle(report *crashReport, stderr string, logPath string) (string, error) {
+	dir := filepath.Join(sessionTmpDir(), crashesDir, fmt.Sprintf("%s-%s", report.Profile, report.Time.Format("20060102-150405")))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stderr.txt"), []byte(stderr), 0600); err != nil {
+		return "", err
+	}
+	// The log is still being written, a copy of what is there is enough
+	if log, err := os.ReadFile(logPath); err == nil {
+		os.WriteFile(filepath.Join(dir, filepath.Base(logPath)), log, 0600)
+	}
+	return dir, nil
+}
+
+// newCrashReport collects the environment details of a crash
+func newCrashReport(profile string, exitCode int, args []string, envNames []string) *crashReport {
+	report := &crashReport{
+		Profile:     profile,
+		Time:        clockNow(),
+		ExitCode:    exitCode,
+		Args:        args,
+		Environment: envNames,
+		OS:          runtime.GOOS + "/" + runtime.GOARCH,
+		Wrapper:     runtime.Version(),
+	}
+	var err error
+	if report.NodePath, report.NodeVersion, err = checkNode(); err != nil {
+		report.NodeError = err.Error()
+	}
+	report.NpxPath, _ = exec.LookPath("npx")
+	return report
+}
+
+// quarantined returns the quarantine of a profile, nil when it may start
+func quarantined(profile string) *Quarantine {
+	registry, err := readRegistry()
+	if err != nil {
+		return nil
+	}
+	if record, ok := registry.Profiles[profile]; ok {
+		return record.Quarantined
+	}
+	return nil
+}
+
+// releaseProfile lifts the quarantine of a profile and forgets its crashes
+func releaseProfile(profile string) (bool, error) {
+	released := false
+	err := updateRegistry(func(registry *Registry) error {
+		if record, ok := registry.Profiles[profile]; ok {
+			released = record.Quarantined != nil
+			record.Quarantined = nil
+			record.Crashes = nil
+		}
+		return nil
+	})
+	return released, err
+}
+
+// runProfilesRelease implements "playwrightwrap profiles release <profile>"
+func runProfilesRelease(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap profiles release <profile>")
+		return 2
+	}
+	released, err := releaseProfile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to update registry: %v\n", err)
+		return 1
+	}
+	if !released {
+		fmt.Fprintf(os.Stderr, "Profile %s is not quarantined\n", args[0])
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Released profile %s from quarantine\n", args[0])
+	return 0
+}
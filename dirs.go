@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const (
+	appDirName       = "playwrightwrap"
+	configFileName   = "playwrightwrap.json"
+	legacyConfigPath = "./playwrightwrap.json"
+)
+
+// appDirs are the locations the wrapper keeps its files in
+type appDirs struct {
+	// config holds the config file
+	config string
+	// profiles holds the storage states of the profiles
+	profiles string
+	// state holds session copies, logs, the registry and control sockets
+	state string
+}
+
+// platformDirs returns the platform's conventional locations: the XDG base directories
+// on Linux, Application Support on macOS and %APPDATA%/%LOCALAPPDATA% on Windows.
+// PLAYWRIGHTWRAP_HOME roots everything in one directory with the legacy layout instead.
+func platformDirs() appDirs {
+	if home := os.Getenv("PLAYWRIGHTWRAP_HOME"); home != "" {
+		return legacyDirs(home)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return legacyDirs(".")
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		base := filepath.Join(home, "Library", "Application Support", appDirName)
+		return appDirs{config: base, profiles: filepath.Join(base, "profiles"), state: filepath.Join(base, "tmp")}
+	case "windows":
+		roaming := envOr("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+		local := filepath.Join(envOr("LOCALAPPDATA", filepath.Join(home, "AppData", "Local")), appDirName)
+		return appDirs{config: filepath.Join(roaming, appDirName), profiles: filepath.Join(local, "profiles"), state: filepath.Join(local, "tmp")}
+	default:
+		return appDirs{
+			config:   filepath.Join(envOr("XDG_CONFIG_HOME", filepath.Join(home, ".config")), appDirName),
+			profiles: filepath.Join(envOr("XDG_DATA_HOME", filepath.Join(home, ".local", "share")), appDirName, "profiles"),
+			state:    filepath.Join(envOr("XDG_STATE_HOME", filepath.Join(home, ".local", "state")), appDirName),
+		}
+	}
+}
+
+// legacyDirs is the layout relative to root used before platform directories
+func legacyDirs(root string) appDirs {
+	return appDirs{config: root, profiles: filepath.Join(root, "browser_profile"), state: filepath.Join(root, "tmp")}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// profilesDir returns the directory holding the profiles
+func profilesDir() string {
+	return platformDirs().profiles
+}
+
+// sessionTmpDir returns the directory for session copies, logs and shared state
+func sessionTmpDir() string {
+	return platformDirs().state
+}
+
+// defaultConfigPath returns the config file location. A playwrightwrap.json in the
+// working directory takes precedence, so projects can carry their own config.
+func defaultConfigPath() string {
+	if _, err := os.Stat(legacyConfigPath); err == nil {
+		return legacyConfigPath
+	}
+	return filepath.Join(platformDirs().config, configFileName)
+}
+
+// legacyMigratedFile in the state directory records that migrateLegacyLayout has run
+const legacyMigratedFile = "legacy-layout-migrated"
+
+// migrateLegacyLayout moves browser_profile and the registry in tmp next to the binary,
+// where earlier versions kept them, to the platform directories. It runs once: the
+// result is recorded in the state directory, and a legacy directory that is left in
+// place because the platform directories already have one is reported.
+func migrateLegacyLayout() {
+	if os.Getenv("PLAYWRIGHTWRAP_HOME") != "" {
+		return
+	}
+	dirs := platformDirs()
+	record := filepath.Join(dirs.state, legacyMigratedFile)
+	if _, err := os.Stat(record); err == nil {
+		return
+	}
+	root, err := getExecutableDir()
+	if err != nil {
+		return
+	}
+	legacy := legacyDirs(root)
+	if dirs == legacy {
+		return
+	}
+	moves := []struct{ from, to string }{
+		{legacy.profiles, dirs.profiles},
+		// Only the registry is worth keeping, the rest of tmp belongs to past sessions
+		{filepath.Join(legacy.state, registryFile), filepath.Join(dirs.state, registryFile)},
+	}
+	failed := false
+	for _, move := range moves {
+		if _, err := os.Stat(move.from); err != nil {
+			continue
+		}
+		if _, err := os.Stat(move.to); err == nil {
+			fmt.Fprintf(os.Stderr, "playwrightwrap: warning: left %s in place, %s already exists; merge them by hand\n", move.from, move.to)
+			continue
+		}
+		if err := moveTree(move.from, move.to); err != nil {
+			fmt.Fprintf(os.Stderr, "playwrightwrap: failed to move %s to %s: %v\n", move.from, move.to, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "playwrightwrap: moved %s to %s\n", move.from, move.to)
+	}
+	// A failed move is tried again on the next run
+	if failed {
+		return
+	}
+	err = os.MkdirAll(dirs.state, 0700)
+	if err == nil {
+		err = writeFileAtomic(record, []byte(time.Now().Format(time.RFC3339)+"\n"), 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: warning: failed to record the legacy layout migration: %v\n", err)
+	}
+}
+
+// moveTree renames from to to, copying when they are on different file systems
+func moveTree(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		return copyFile(path, target)
+	})
+	if err != nil {
+		os.RemoveAll(to)
+		return err
+	}
+	return os.RemoveAll(from)
+}
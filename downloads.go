@@ -0,0 +1,228 @@
+package main
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultDownloadsDir  = "./output"
+	downloadPollInterval = time.Second
+	// childTracesDir is where the child keeps traces below its output directory
+	childTracesDir = "traces"
+)
+
+// downloadRecord describes a file that appeared in the managed directory during the session
+type downloadRecord struct {
+	Path     string
+	Size     int64
+	Type     string
+	Rejected bool
+}
+
+// DownloadTracker watches the child's output directory for new files and removes the
+// ones not covered by the allowlist. With an empty allowlist every file is kept. The
+// child saves its own files, such as screenshots, PDFs and traces, to the same
+// directory; those are not downloads and are left alone.
+type DownloadTracker struct {
+	logger     *Logger
+	dir        string
+	extensions map[string]bool
+	types      []string
+
+	mu      sync.Mutex
+	seen    map[string]int64
+	claimed map[string]bool
+	records []downloadRecord
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewDownloadTracker creates a tracker for dir, remembering files that already exist
+func NewDownloadTracker(config *DownloadsConfig, logger *Logger) (*DownloadTracker, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = defaultDownloadsDir
+	}
+	// Absolute, so that it matches the paths the child reports and works for a child
+	// running in another directory
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	t := &DownloadTracker{
+		logger:     logger,
+		dir:        dir,
+		extensions: make(map[string]bool),
+		types:      config.AllowedTypes,
+		seen:       make(map[string]int64),
+		claimed:    make(map[string]bool),
+	}
+	for _, ext := range config.AllowedExtensions {
+		t.extensions[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	t.walk(func(path string, info fs.FileInfo) {
+		t.seen[path] = -1
+	})
+	return t, nil
+}
+
+// Dir returns the managed directory
+func (t *DownloadTracker) Dir() string {
+	return t.dir
+}
+
+// Claim marks the files below the managed directory that a tool result names as saved
+// by the child itself. The child reports them by absolute path. A nil tracker claims
+// nothing.
+func (t *DownloadTracker) Claim(resultText string) {
+	if t == nil || !strings.Contains(resultText, t.dir) {
+		return
+	}
+	fields := strings.FieldsFunc(resultText, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("()[]<>\"'`", r)
+	})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, field := range fields {
+		path := strings.TrimRight(field, ".,;:")
+		if rel, err := filepath.Rel(t.dir, path); err == nil && filepath.IsAbs(path) && rel != "." && !strings.HasPrefix(rel, "..") {
+			t.claimed[filepath.Clean(path)] = true
+		}
+	}
+}
+
+// Start polls the directory in the background until Stop is called
+func (t *DownloadTracker) Start() {
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(downloadPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.scan(false)
+			}
+		}
+	}()
+}
+
+// Stop ends polling, checks the directory one last time and returns the tracked files
+func (t *DownloadTracker) Stop() []downloadRecord {
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+	}
+	t.scan(true)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]downloadRecord(nil), t.records...)
+}
+
+// scan records new files. Files are only judged once their size stopped changing
+// between two polls, unless final is set.
+func (t *DownloadTracker) scan(final bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.walk(func(path string, info fs.FileInfo) {
+		previous, known := t.seen[path]
+		if previous == -1 {
+			return
+		}
+		if !final && (!known || previous != info.Size()) {
+			t.seen[path] = info.Size()
+			return
+		}
+		t.seen[path] = -1
+		if t.claimed[path] {
+			t.logger.Log("Not tracking %s, the child saved it", path)
+			return
+		}
+		t.judge(path, info.Size())
+	})
+}
+
+// judge checks one finished file against the allowlist
+func (t *DownloadTracker) judge(path string, size int64) {
+	record := downloadRecord{Path: path, Size: size, Type: detectType(path)}
+	if !t.allowed(path, record.Type) {
+		record.Rejected = true
+		if err := os.Remove(path); err != nil {
+			t.logger.Log("Failed to remove disallowed download %s: %v", path, err)
+		} else {
+			t.logger.Log("Removed disallowed download %s (%s)", path, record.Type)
+		}
+	} else {
+		t.logger.Log("Download tracked: %s (%s, %d bytes)", path, record.Type, size)
+	}
+	t.records = append(t.records, record)
+}
+
+// allowed reports whether a file matches the extension or MIME type allowlist
+func (t *DownloadTracker) allowed(path string, mimeType string) bool {
+	if len(t.extensions) == 0 && len(t.types) == 0 {
+		return true
+	}
+	if t.extensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))] {
+		return true
+	}
+	for _, pattern := range t.types {
+		if pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every regular file below the managed directory, except the traces
+func (t *DownloadTracker) walk(fn func(path string, info fs.FileInfo)) {
+	traces := filepath.Join(t.dir, childTracesDir)
+	filepath.WalkDir(t.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && path == traces {
+			return fs.SkipDir
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		fn(path, info)
+		return nil
+	})
+}
+
+// detectType sniffs the MIME type of a file, falling back to its extension
+func detectType(path string) string {
+	file, err := os.Open(path)
+	if err == nil {
+		defer file.Close()
+		buf := make([]byte, 512)
+		n, _ := file.Read(buf)
+		if detected := http.DetectContentType(buf[:n]); detected != "application/octet-stream" {
+			return strings.SplitN(detected, ";", 2)[0]
+		}
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+		return strings.SplitN(byExt, ";", 2)[0]
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const enableEchoInput = 0x0004
+
+// disableEcho stops the console on stdin echoing what is typed and returns the function
+// that turns echo back on. It does nothing when stdin is not a console.
+func disableEcho() func() {
+	handle := syscall.Handle(os.Stdin.Fd())
+	var mode uint32
+	if syscall.GetConsoleMode(handle, &mode) != nil {
+		return func() {}
+	}
+	setConsoleMode := syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+	if ok, _, _ := setConsoleMode.Call(uintptr(handle), uintptr(mode&^enableEchoInput)); ok == 0 {
+		return func() {}
+	}
+	return func() { setConsoleMode.Call(uintptr(handle), uintptr(mode)) }
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+// EnvironmentConfig sets variables in the child's environment to tune Playwright
+type EnvironmentConfig struct {
+	// BrowsersPath sets PLAYWRIGHT_BROWSERS_PATH, where Playwright looks for and installs browsers
+	BrowsersPath string `json:"browsersPath,omitempty"`
+	// SkipBrowserDownload sets PLAYWRIGHT_SKIP_BROWSER_DOWNLOAD so npx never fetches browsers
+	SkipBrowserDownload bool `json:"skipBrowserDownload,omitempty"`
+	// Debug sets DEBUG, such as "pw:api" or "pw:*" for Playwright's debug logs
+	Debug string `json:"debug,omitempty"`
+	// Vars are set as given, after the keys above
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// variables returns the settings as a name to value map
+func (e *EnvironmentConfig) variables() map[string]string {
+	vars := map[string]string{}
+	if e == nil {
+		return vars
+	}
+	if e.BrowsersPath != "" {
+		vars["PLAYWRIGHT_BROWSERS_PATH"] = e.BrowsersPath
+	}
+	if e.SkipBrowserDownload {
+		vars["PLAYWRIGHT_SKIP_BROWSER_DOWNLOAD"] = "1"
+	}
+	if e.Debug != "" {
+		vars["DEBUG"] = e.Debug
+	}
+	for name, value := range e.Vars {
+		vars[name] = value
+	}
+	return vars
+}
+
+// childEnv returns the wrapper's environment with the configured variables applied, the
+// profile's settings taking precedence over the top-level ones. It also returns the names
+// of the variables that were set.
+func (c *Config) childEnv(profile string) ([]string, []string) {
+	vars := c.Environment.variables()
+	// A pinned browser binary must not be replaced by a download
+	if c.Profile(profile).ExecutablePath != "" {
+		vars["PLAYWRIGHT_SKIP_BROWSER_DOWNLOAD"] = "1"
+	}
+	for name, value := range c.Profile(profile).Environment.variables() {
+		vars[name] = value
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := os.Environ()
+	for _, name := range names {
+		env = append(env, name+"="+vars[name])
+	}
+	return env, names
+}
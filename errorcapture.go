@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultErrorCaptureDir = "./error-captures"
+	errorCaptureTimeout    = 30 * time.Second
+)
+
+// ErrorCaptureConfig captures the page when a tool call fails
+type ErrorCaptureConfig struct {
+	// Dir receives the captures, ./error-captures by default
+	Dir string `json:"dir,omitempty"`
+	// Snapshot also saves the page's accessibility snapshot next to the screenshot
+	Snapshot bool `json:"snapshot,omitempty"`
+}
+
+// errorCaptureRecord is the evidence saved for one failed call
+type errorCaptureRecord struct {
+	Tool       string
+	Screenshot string
+	Snapshot   string
+}
+
+// ErrorCapture takes a screenshot through the child after a tool call fails. Captures
+// run one at a time in the background; failures while one runs are not captured.
+type ErrorCapture struct {
+	dir       string
+	snapshot  bool
+	proxy     *Proxy
+	logger    *Logger
+	sessionID string
+
+	mu       sync.Mutex
+	busy     bool
+	seq      int
+	captures []errorCaptureRecord
+	wg       sync.WaitGroup
+}
+
+// NewErrorCapture creates the capture directory
+func NewErrorCapture(config *ErrorCaptureConfig, proxy *Proxy, logger *Logger, sessionID string) (*ErrorCapture, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = defaultErrorCaptureDir
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &ErrorCapture{dir: dir, snapshot: config.Snapshot, proxy: proxy, logger: logger, sessionID: sessionID}, nil
+}
+
+// Capture saves evidence of the page after call failed with reason. A nil ErrorCapture
+// captures nothing.
+func (c *ErrorCapture) Capture(call *toolCall, reason string) {
+	if c == nil || call.Name == "browser_take_screenshot" || call.Name == "browser_snapshot" || call.Name == "browser_close" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.busy {
+		c.logger.Log("Not capturing the %s failure, a capture is still running", call.Name)
+		return
+	}
+	c.busy = true
+	c.seq++
+	base := filepath.Join(c.dir, fmt.Sprintf("%s-%03d-%s", c.sessionID, c.seq, call.Name))
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		record := c.capture(call.Name, base)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.busy = false
+		if record.Screenshot != "" || record.Snapshot != "" {
+			c.captures = append(c.captures, record)
+			c.logger.Log("Captured the %s failure (%s): screenshot %s, snapshot %s", call.Name, reason, orNone(record.Screenshot), orNone(record.Snapshot))
+		}
+	}()
+}
+
+func (c *ErrorCapture) capture(tool, base string) errorCaptureRecord {
+	record := errorCaptureRecord{Tool: tool}
+	if path, err := c.screenshot(base); err != nil {
+		c.logger.Log("Failed to take a screenshot after the %s failure: %v", tool, err)
+	} else {
+		record.Screenshot = path
+	}
+	if c.snapshot {
+		result, err := c.proxy.CallTool("browser_snapshot", nil, errorCaptureTimeout)
+		if err == nil {
+			path := base + ".md"
+			if err = os.WriteFile(path, []byte(c.proxy.redactor.String(redactResponses, result.text())), 0600); err == nil {
+				record.Snapshot = path
+			}
+		}
+		if err != nil {
+			c.logger.Log("Failed to save a snapshot after the %s failure: %v", tool, err)
+		}
+	}
+	return record
+}
+
+// screenshot asks the child for a screenshot and writes the image it returns
+func (c *ErrorCapture) screenshot(base string) (string, error) {
+	result, err := c.proxy.CallTool("browser_take_screenshot", nil, errorCaptureTimeout)
+	if err != nil {
+		return "", err
+	}
+	for _, content := range result.Content {
+		if content.Type != "image" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(content.Data)
+		if err != nil {
+			return "", fmt.Errorf("invalid image data: %v", err)
+		}
+		ext := ".png"
+		if content.MimeType == "image/jpeg" {
+			ext = ".jpg"
+		}
+		path := base + ext
+		return path, os.WriteFile(path, data, 0600)
+	}
+	return "", errors.New("the result holds no image")
+}
+
+// Stop waits for running captures and returns what was captured
+func (c *ErrorCapture) Stop() []errorCaptureRecord {
+	if c == nil {
+		return nil
+	}
+	c.wg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.captures
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// validateExecutable checks that path names an existing executable file and returns its
+// absolute form, since the child may resolve relative paths against another directory
+func validateExecutable(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("browser executable %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("browser executable %s is a directory", path)
+	}
+	// Windows has no executable bit, the extension decides
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("browser executable %s is not executable", path)
+	}
+	return abs, nil
+}
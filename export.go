@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runExport implements "playwrightwrap export", converting a profile's cookies for other tools
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile to export")
+	format := flags.String("format", "netscape", "output format: netscape (cookies.txt) or curl (a value for curl -b)")
+	domains := flags.String("domains", "", "comma separated domains to export cookies for, all when empty")
+	output := flags.String("output", "", "file to write to, stdout when empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	source := config.storageStatePath(*profile)
+	state, err := loadStorageState(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read storage state %s: %v\n", source, err)
+		return 1
+	}
+
+	domainList := splitList(*domains)
+	var cookies []Cookie
+	for _, cookie := range state.Cookies {
+		if matchesDomain(cookie.Domain, domainList) {
+			cookies = append(cookies, cookie)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *output, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "netscape":
+		err = writeNetscapeJar(w, cookies)
+	case "curl":
+		_, err = fmt.Fprintln(w, curlCookieHeader(cookies))
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported format %q, expected netscape or curl\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write cookies: %v\n", err)
+		return 1
+	}
+	return 0
+}
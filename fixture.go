@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// recordedReply is the result or error a server sent for one recorded request
+type recordedReply struct {
+	Result json.RawMessage
+	Error  *rpcError
+}
+
+// Fixture answers MCP requests from a recorded session instead of a live browser
+type Fixture struct {
+	logger *Logger
+	exact  map[string][]recordedReply
+	loose  map[string][]recordedReply
+}
+
+// LoadFixture builds a fixture from a session recording
+func LoadFixture(path string, logger *Logger) (*Fixture, error) {
+	entries, err := readRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{
+		logger: logger,
+		exact:  make(map[string][]recordedReply),
+		loose:  make(map[string][]recordedReply),
+	}
+	type requestKeys struct{ exact, loose string }
+	inflight := make(map[string]requestKeys)
+	for _, entry := range entries {
+		var msg rpcMessage
+		if err := json.Unmarshal(entry.Message, &msg); err != nil {
+			continue
+		}
+		switch {
+		case entry.From == directionClient && msg.isRequest():
+			inflight[string(msg.ID)] = requestKeys{exactKey(&msg), looseKey(&msg)}
+		case entry.From == directionServer && msg.isResponse():
+			keys, ok := inflight[string(msg.ID)]
+			if !ok {
+				continue
+			}
+			delete(inflight, string(msg.ID))
+			reply := recordedReply{Result: msg.Result, Error: msg.Error}
+			f.exact[keys.exact] = append(f.exact[keys.exact], reply)
+			f.loose[keys.loose] = append(f.loose[keys.loose], reply)
+		}
+	}
+	if len(f.exact) == 0 {
+		return nil, fmt.Errorf("recording %s contains no request/response pairs", path)
+	}
+	return f, nil
+}
+
+// Serve answers requests read from r on w until r is closed
+func (f *Fixture) Serve(r io.Reader, w io.Writer) error {
+	out := &lineWriter{w: w}
+	lr := newLineReader(r)
+	for {
+		line, err := lr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			f.logger.Log("Fixture: ignoring malformed message: %v", err)
+			continue
+		}
+		if !msg.isRequest() {
+			continue
+		}
+
+		reply, ok := f.next(&msg)
+		response := rpcMessage{JSONRPC: "2.0", ID: msg.ID}
+		if ok {
+			response.Result = reply.Result
+			response.Error = reply.Error
+		} else {
+			f.logger.Log("Fixture: no recorded response for %s", looseKey(&msg))
+			response.Error = &rpcError{Code: -32000, Message: "no recorded response for " + looseKey(&msg)}
+		}
+		data, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+		if err := out.Write(data); err != nil {
+			return err
+		}
+	}
+}
+
+// next returns the recorded reply for a request, preferring an exact match of its
+// parameters. Replies to repeated requests are served in recorded order, and the
+// last one keeps being served once they run out.
+func (f *Fixture) next(msg *rpcMessage) (recordedReply, bool) {
+	key := exactKey(msg)
+	queue := f.exact
+	if len(queue[key]) == 0 {
+		key = looseKey(msg)
+		queue = f.loose
+		if len(queue[key]) == 0 {
+			return recordedReply{}, false
+		}
+		f.logger.Log("Fixture: no exact match, serving recorded response for %s", key)
+	}
+	replies := queue[key]
+	reply := replies[0]
+	if len(replies) > 1 {
+		queue[key] = replies[1:]
+	}
+	return reply, true
+}
+
+// exactKey identifies a request by method and canonical parameters, ignoring _meta
+func exactKey(msg *rpcMessage) string {
+	var params map[string]interface{}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return msg.Method + " " + string(msg.Params)
+	}
+	delete(params, "_meta")
+	canonical, _ := json.Marshal(params)
+	return msg.Method + " " + string(canonical)
+}
+
+// looseKey identifies a request by method, plus the tool name for tool calls
+func looseKey(msg *rpcMessage) string {
+	if msg.Method == "tools/call" {
+		var params struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		return msg.Method + " " + params.Name
+	}
+	return msg.Method
+}
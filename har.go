@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// harFile holds the parts of a HAR capture that carry cookies
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				URL     string      `json:"url"`
+				Cookies []harCookie `json:"cookies"`
+			} `json:"request"`
+			Response struct {
+				Cookies []harCookie `json:"cookies"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path"`
+	Domain   string `json:"domain"`
+	Expires  string `json:"expires"`
+	HTTPOnly bool   `json:"httpOnly"`
+	Secure   bool   `json:"secure"`
+	SameSite string `json:"sameSite"`
+}
+
+// readHARCookies extracts cookies from a HAR capture. Cookies set by responses are
+// taken with their attributes; cookies only seen on requests are added as host-only
+// session cookies, since they were presumably set before the capture started.
+func readHARCookies(path string) ([]Cookie, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file %s: %v", path, err)
+	}
+
+	var set []Cookie
+	var sent []Cookie
+	setNames := make(map[string]bool)
+	for _, entry := range har.Log.Entries {
+		requestURL, err := url.Parse(entry.Request.URL)
+		if err != nil || requestURL.Hostname() == "" {
+			continue
+		}
+		host := requestURL.Hostname()
+		for _, c := range entry.Response.Cookies {
+			cookie := harToCookie(c, host)
+			set = append(set, cookie)
+			setNames[c.Name+"@"+host] = true
+		}
+		for _, c := range entry.Request.Cookies {
+			c.Secure = requestURL.Scheme == "https"
+			sent = append(sent, harToCookie(c, host))
+		}
+	}
+
+	cookies := set
+	for _, cookie := range sent {
+		if !setNames[cookie.Name+"@"+cookie.Domain] {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies, nil
+}
+
+// harToCookie converts a HAR cookie, filling in defaults from the request host
+func harToCookie(c harCookie, host string) Cookie {
+	cookie := Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Expires:  -1,
+		HTTPOnly: c.HTTPOnly,
+		Secure:   c.Secure,
+		SameSite: "Lax",
+	}
+	if cookie.Domain == "" {
+		cookie.Domain = host
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if c.Expires != "" {
+		if expires, err := time.Parse(time.RFC3339, c.Expires); err == nil {
+			cookie.Expires = float64(expires.Unix())
+		}
+	}
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		cookie.SameSite = "Strict"
+	case "none":
+		cookie.SameSite = "None"
+	}
+	return cookie
+}
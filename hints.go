@@ -0,0 +1,55 @@
+package main
+
+import "regexp"
+
+// errorHint pairs a well-known child failure with advice for fixing it
+type errorHint struct {
+	pattern *regexp.Regexp
+	hint    string
+}
+
+var errorHints = []errorHint{
+	{
+		regexp.MustCompile(`(?i)Executable doesn't exist at|distribution '[^']+' is not found|Please run the following command to download new browsers|browserType\.launch: .*not found`),
+		"the browser is not installed; run `playwrightwrap warm` (or `npx playwright install <browser>`) on this machine",
+	},
+	{
+		regexp.MustCompile(`(?i)No usable sandbox|Running as root without --no-sandbox|setuid sandbox`),
+		"Chromium cannot start its sandbox; run the wrapper as a non-root user or pass --no-sandbox",
+	},
+	{
+		regexp.MustCompile(`EADDRINUSE`),
+		"the port is already in use; stop the other server or choose a different --port",
+	},
+	{
+		regexp.MustCompile(`(?i)407 Proxy Authentication Required|ERR_PROXY_AUTH|npm (ERR!|error) code E407`),
+		"the HTTP proxy requires authentication; put credentials in HTTPS_PROXY or in npm's proxy settings",
+	},
+	{
+		regexp.MustCompile(`(?i)ProcessSingleton|profile appears to be in use|SingletonLock|user data directory is already in use`),
+		"the browser profile directory is locked by another browser; close it or remove the stale SingletonLock file",
+	},
+	{
+		regexp.MustCompile(`(?i)Missing X server or \$DISPLAY|cannot open display`),
+		"no display is available; pass --headless or run under xvfb-run",
+	},
+	{
+		regexp.MustCompile(`(?i)canceled due to missing packages|npm (ERR!|error) canceled`),
+		"npx would have to install @playwright/mcp first; run `playwrightwrap warm`, or set npxInstall to yes",
+	},
+	{
+		registryFailure,
+		"the npm registry could not be reached; check network and proxy settings, or prefetch with `playwrightwrap warm`",
+	},
+}
+
+// matchHints returns the hints for every known failure found in the child's stderr
+func matchHints(stderr string) []string {
+	var hints []string
+	for _, h := range errorHints {
+		if h.pattern.MatchString(stderr) {
+			hints = append(hints, h.hint)
+		}
+	}
+	return hints
+}
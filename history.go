@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryDir = "./history"
+	historyJSON       = "json"
+	historyCSV        = "csv"
+)
+
+// HistoryConfig exports the pages a session visited when it ends
+type HistoryConfig struct {
+	// Dir receives one <session id>.<format> file per session, ./history by default
+	Dir string `json:"dir,omitempty"`
+	// Format is "json" (the default) or "csv"
+	Format string `json:"format,omitempty"`
+}
+
+// historyEntry is one page the session arrived at
+type historyEntry struct {
+	Time time.Time `json:"time"`
+	URL  string    `json:"url"`
+	// Tool and Arguments are the call that led to the page
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// NavigationHistory reconstructs the session's navigations from the page URLs the child
+// reports in tool results, so clicks and redirects count as well as browser_navigate
+type NavigationHistory struct {
+	dir      string
+	format   string
+	redactor *Redactor
+
+	mu      sync.Mutex
+	current string
+	entries []historyEntry
+}
+
+// NewNavigationHistory creates the history export, creating its directory
+func NewNavigationHistory(config *HistoryConfig, redactor *Redactor) (*NavigationHistory, error) {
+	format := config.Format
+	if format == "" {
+		format = historyJSON
+	}
+	if format != historyJSON && format != historyCSV {
+		return nil, fmt.Errorf("unknown history format %q, expected %s or %s", format, historyJSON, historyCSV)
+	}
+	dir := config.Dir
+	if dir == "" {
+		dir = defaultHistoryDir
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &NavigationHistory{dir: dir, format: format, redactor: redactor}, nil
+}
+
+// Observe records the page a successful tool call left the browser on, if it changed or
+// was navigated to again. A nil history observes nothing.
+func (h *NavigationHistory) Observe(call *toolCall, url string) {
+	if h == nil || url == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if url == h.current && call.Name != "browser_navigate" {
+		return
+	}
+	h.current = url
+	entry := historyEntry{Time: clockNow(), URL: h.redactor.String(redactLogs, url), Tool: call.Name}
+	if len(call.Arguments) > 0 {
+		if data, err := json.Marshal(call.Arguments); err == nil {
+			entry.Arguments = h.redactor.JSON(redactLogs, data)
+		}
+	}
+	h.entries = append(h.entries, entry)
+}
+
+// Write exports the history of the session and returns the file it wrote
+func (h *NavigationHistory) Write(sessionID string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	path := filepath.Join(h.dir, sessionID+"."+h.format)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if h.format == historyJSON {
+		entries := h.entries
+		if entries == nil {
+			entries = []historyEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		_, err = file.Write(append(data, '\n'))
+		return path, err
+	}
+	w := csv.NewWriter(file)
+	w.Write([]string{"time", "url", "tool", "arguments"})
+	for _, entry := range h.entries {
+		w.Write([]string{entry.Time.Format(time.RFC3339Nano), entry.URL, entry.Tool, string(entry.Arguments)})
+	}
+	w.Flush()
+	return path, w.Error()
+}
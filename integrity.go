@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// What a checkpoint does when the profile was written by someone else since this
+// session copied or last saved it
+const (
+	conflictMerge = "merge"
+	conflictAbort = "abort"
+)
+
+// fileChecksum returns the SHA-256 of a file, "" if it does not exist
+func fileChecksum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeBack writes the live state to the profile under the registry lock, so parallel
+// sessions cannot lose each other's updates. If the profile no longer has the checksum
+// this session last saw, the state is merged into it or the write is aborted.
+func (c *Checkpointer) writeBack(state *StorageState) error {
+	return updateRegistry(func(registry *Registry) error {
+		record := registry.profile(c.profile)
+		current, err := fileChecksum(c.profilePath)
+		if err != nil {
+			return err
+		}
+		target := state
+		conflict := current != c.baseline
+		if conflict {
+			by := "another process"
+			if record.StateChecksum == current && record.StateWrittenBy != "" {
+				by = fmt.Sprintf("session %s at %s", record.StateWrittenBy, record.StateWrittenAt.Format(time.RFC3339))
+			}
+			if c.onConflict == conflictAbort {
+				return fmt.Errorf("%s was changed by %s since this session read it, not writing back", c.profilePath, by)
+			}
+			c.logger.Log("%s was changed by %s since this session read it, merging", c.profilePath, by)
+		}
+		if conflict || c.strategy == strategyMerge {
+			if existing, err := loadStorageState(c.profilePath); err == nil {
+				target = mergeStorageState(existing, state)
+			}
+		}
+		if err := target.save(c.profilePath); err != nil {
+			return fmt.Errorf("failed to write back %s: %v", c.profilePath, err)
+		}
+		if c.baseline, err = fileChecksum(c.profilePath); err != nil {
+			return err
+		}
+		record.StateChecksum = c.baseline
+		record.StateWrittenBy = c.sessionID
+		record.StateWrittenAt = clockNow()
+		return nil
+	})
+}
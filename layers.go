@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// buildLayeredState builds the session copy of a profile. The states of its layers are
+// merged in order, each prepared like a session copy of that profile, and the profile's
+// own state goes on top. It also returns the merged layers, nil without any, so that
+// write-backs can leave out what came from them.
+func buildLayeredState(config *Config, profile string, logger *Logger) ([]byte, *StorageState, error) {
+	profileConfig := config.Profile(profile)
+	path := config.storageStatePath(profile)
+	if len(profileConfig.Layers) == 0 {
+		data, err := buildSessionState(path, profileConfig, logger)
+		return data, nil, err
+	}
+
+	base := &StorageState{}
+	for _, layer := range profileConfig.Layers {
+		if layer == profile {
+			return nil, nil, fmt.Errorf("profile %s lists itself as a layer", profile)
+		}
+		layerConfig := config.Profile(layer)
+		if len(layerConfig.Layers) > 0 {
+			return nil, nil, fmt.Errorf("layer %s of profile %s has layers of its own", layer, profile)
+		}
+		state, err := loadLayer(config.storageStatePath(layer), layerConfig, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("layer %s: %v", layer, err)
+		}
+		base = mergeStorageState(base, state)
+		logger.Log("Layer %s: %d cookies, %d origins", layer, len(state.Cookies), len(state.Origins))
+	}
+
+	// The top layer starts out empty until the first write-back creates it
+	top := &StorageState{}
+	if _, err := os.Stat(path); err == nil {
+		if top, err = loadLayer(path, profileConfig, logger); err != nil {
+			return nil, nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	data, err := mergeStorageState(base, top).marshal()
+	return data, base, err
+}
+
+// loadLayer reads one layer the way its profile's session copy would be prepared
+func loadLayer(path string, profile *ProfileConfig, logger *Logger) (*StorageState, error) {
+	data, err := buildSessionState(path, profile, logger)
+	if err != nil {
+		return nil, err
+	}
+	state := &StorageState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid storage state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// topLayer returns the part of the live state that differs from the lower layers: cookies
+// and localStorage entries they do not have or whose value changed, and IndexedDB that
+// is not theirs. What the session deleted from a lower layer cannot be expressed and
+// comes back in the next session.
+func topLayer(live *StorageState, base *StorageState) *StorageState {
+	top := &StorageState{}
+	baseCookies := make(map[cookieKey]string)
+	for _, cookie := range base.Cookies {
+		baseCookies[cookieKey{cookie.Name, cookie.Domain, cookie.Path}] = cookie.Value
+	}
+	for _, cookie := range live.Cookies {
+		if value, ok := baseCookies[cookieKey{cookie.Name, cookie.Domain, cookie.Path}]; ok && value == cookie.Value {
+			continue
+		}
+		top.Cookies = append(top.Cookies, cookie)
+	}
+
+	baseOrigins := make(map[string]*OriginState)
+	for i := range base.Origins {
+		baseOrigins[base.Origins[i].Origin] = &base.Origins[i]
+	}
+	for _, origin := range live.Origins {
+		baseOrigin, ok := baseOrigins[origin.Origin]
+		if !ok {
+			top.Origins = append(top.Origins, origin)
+			continue
+		}
+		baseValues := make(map[string]string)
+		for _, entry := range baseOrigin.LocalStorage {
+			baseValues[entry.Name] = entry.Value
+		}
+		changed := OriginState{Origin: origin.Origin}
+		for _, entry := range origin.LocalStorage {
+			if value, ok := baseValues[entry.Name]; !ok || value != entry.Value {
+				changed.LocalStorage = append(changed.LocalStorage, entry)
+			}
+		}
+		if !bytes.Equal(origin.IndexedDB, baseOrigin.IndexedDB) {
+			changed.IndexedDB = origin.IndexedDB
+		}
+		if len(changed.LocalStorage) > 0 || len(changed.IndexedDB) > 0 {
+			top.Origins = append(top.Origins, changed)
+		}
+	}
+	return top
+}
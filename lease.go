@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Lease expiry modes
+const (
+	leaseRevoke    = "revoke"
+	leaseAnonymous = "anonymous"
+)
+
+const eventLeaseExpired = "lease_expired"
+
+// leaseCloseTimeout bounds closing the browser when a lease expires
+const leaseCloseTimeout = 30 * time.Second
+
+// LeaseConfig hands a session the profile's credentials for a bounded time
+type LeaseConfig struct {
+	// Duration is how long the session holds the storage state, counted from the start
+	Duration Duration `json:"duration"`
+	// OnExpiry is revoke to close the browser and refuse further tool calls, or anonymous
+	// to close it and let later calls continue without credentials. Default revoke.
+	OnExpiry string `json:"onExpiry,omitempty"`
+}
+
+// Lease revokes the session's storage state when its time is up
+type Lease struct {
+	onExpiry string
+	duration time.Duration
+	proxy    *Proxy
+	logger   *Logger
+	tempPath string
+	// checkpointer writes the state back a last time before it is revoked, nil if the
+	// profile has no checkpoints
+	checkpointer *Checkpointer
+	events       eventSink
+
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+// NewLease creates a lease over the session copy of the storage state at tempPath
+func NewLease(config *LeaseConfig, proxy *Proxy, logger *Logger, tempPath string) (*Lease, error) {
+	if config.Duration <= 0 {
+		return nil, errors.New("lease duration must be positive")
+	}
+	onExpiry := config.OnExpiry
+	if onExpiry == "" {
+		onExpiry = leaseRevoke
+	}
+	if onExpiry != leaseRevoke && onExpiry != leaseAnonymous {
+		return nil, fmt.Errorf("unknown lease onExpiry %q, expected %s or %s", onExpiry, leaseRevoke, leaseAnonymous)
+	}
+	return &Lease{
+		onExpiry: onExpiry,
+		duration: time.Duration(config.Duration),
+		proxy:    proxy,
+		logger:   logger,
+		tempPath: tempPath,
+	}, nil
+}
+
+// Start begins the lease, when the child is handed the storage state
+func (l *Lease) Start() {
+	l.logger.Log("Credential lease granted for %v", l.duration)
+	l.timer = time.AfterFunc(l.duration, l.expire)
+}
+
+// Stop cancels the lease at the end of the session
+func (l *Lease) Stop() {
+	if l != nil && l.timer != nil {
+		l.timer.Stop()
+	}
+}
+
+// Expired reports whether the lease ran out. A nil lease never does.
+func (l *Lease) Expired() bool {
+	return l != nil && l.expired.Load()
+}
+
+// Check returns why a tool call is refused after a revoked lease, or ""
+func (l *Lease) Check() string {
+	if l.Expired() && l.onExpiry == leaseRevoke {
+		return fmt.Sprintf("the session's credential lease expired after %v", l.duration)
+	}
+	return ""
+}
+
+// expire writes the state back a last time, then removes it from the session and closes
+// the browser, so no page keeps the cookies
+func (l *Lease) expire() {
+	l.logger.Log("Credential lease expired after %v, revoking the storage state", l.duration)
+	select {
+	case <-l.proxy.Ready():
+		if l.checkpointer != nil {
+			l.checkpointer.Stop()
+			if err := l.checkpointer.Save("lease expiry"); err != nil {
+				l.logger.Log("State checkpoint before lease expiry failed: %v", err)
+			}
+		}
+	default:
+	}
+	l.expired.Store(true)
+
+	// New contexts of an anonymous session load an empty state, a revoked one has none
+	var err error
+	if l.onExpiry == leaseAnonymous {
+		err = (&StorageState{}).save(l.tempPath)
+	} else {
+		err = os.Remove(l.tempPath)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		l.logger.Log("Failed to revoke temp state %s: %v", l.tempPath, err)
+	}
+
+	select {
+	case <-l.proxy.Ready():
+		if _, err := l.proxy.CallTool("browser_close", nil, leaseCloseTimeout); err != nil {
+			l.logger.Log("Failed to close the browser at lease expiry: %v", err)
+		}
+		message := "playwrightwrap: the credential lease expired, the browser was closed and further tool calls are refused"
+		if l.onExpiry == leaseAnonymous {
+			message = "playwrightwrap: the credential lease expired, the browser was closed and continues without credentials"
+		}
+		l.proxy.notifyClient("warning", message)
+	default:
+	}
+	if l.events != nil {
+		l.events.Publish(eventLeaseExpired, map[string]interface{}{"duration": l.duration.String(), "onExpiry": l.onExpiry})
+	}
+}
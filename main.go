@@ -8,24 +8,42 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// Where the log goes when the log file cannot be written
+const (
+	logFallbackStderr = "stderr"
+	logFallbackNone   = "none"
+)
+
 // Logger wraps logging functionality
 type Logger struct {
-	enabled bool
-	file    *os.File
+	enabled  bool
+	file     *os.File
+	path     string
+	fallback string
+	mu       sync.Mutex
+	w        io.WriteCloser
+	redactor *Redactor
 }
 
-// NewLogger creates a new logger, enabled if PLAYWRIGHTWRAPLOG env var is set
-func NewLogger(logPath string) *Logger {
-	logger := &Logger{enabled: false}
+// NewLogger creates a new logger, enabled if PLAYWRIGHTWRAPLOG env var is set.
+// The log is gzipped if logPath ends in .gz. If the file cannot be created or written,
+// the logger warns once and continues on stderr, or drops the log with fallback "none".
+func NewLogger(logPath string, fallback string) *Logger {
+	logger := &Logger{enabled: false, path: logPath, fallback: fallback}
 	if os.Getenv("PLAYWRIGHTWRAPLOG") != "" {
+		logger.enabled = true
 		logFile, err := os.Create(logPath)
-		if err == nil {
-			logger.enabled = true
+		if err != nil {
+			logger.degrade(err)
+		} else {
 			logger.file = logFile
+			logger.w = newArtifactWriter(logFile, logPath)
 		}
 	}
 	return logger
@@ -33,70 +51,198 @@ func NewLogger(logPath string) *Logger {
 
 // Log writes a log message with timestamp if logging is enabled
 func (l *Logger) Log(format string, args ...interface{}) {
-	if !l.enabled || l.file == nil {
+	if !l.enabled {
+		return
+	}
+	timestamp := clockNow().Format("2006-01-02 15:04:05.000")
+	message := l.redactor.String(redactLogs, fmt.Sprintf(format, args...))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
 		return
 	}
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	message := fmt.Sprintf(format, args...)
-	fmt.Fprintf(l.file, "[%s] %s\n", timestamp, message)
+	if _, err := fmt.Fprintf(l.w, "[%s] %s\n", timestamp, message); err != nil && l.file != nil {
+		l.degrade(err)
+		if l.w != nil {
+			fmt.Fprintf(l.w, "[%s] %s\n", timestamp, message)
+		}
+	}
+}
+
+// degrade gives up on the log file after err, warning on stderr, and switches to the
+// fallback. It is called with mu held or before the logger is shared.
+func (l *Logger) degrade(err error) {
+	if l.file != nil {
+		l.w.Close()
+		l.file.Close()
+		l.file = nil
+	}
+	l.w = nil
+	if l.fallback == logFallbackNone {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: cannot write log %s: %v, logging is disabled for this session\n", l.path, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "playwrightwrap: cannot write log %s: %v, logging to stderr instead\n", l.path, err)
+	l.w = nopCloser{os.Stderr}
 }
 
 // Close closes the log file
 func (l *Logger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.file != nil {
+		l.w.Close()
 		l.file.Close()
+		l.file = nil
+	}
+}
+
+// validateLogFallback checks the configured log fallback
+func validateLogFallback(fallback string) error {
+	if fallback != "" && fallback != logFallbackStderr && fallback != logFallbackNone {
+		return fmt.Errorf("unknown logFallback %q, expected %s or %s", fallback, logFallbackStderr, logFallbackNone)
 	}
+	return nil
 }
 
 func main() {
-	// Source storage state file
-	storageStatePath := "./browser_profile/storage_state.json"
+	migrateLegacyLayout()
+	applyDeterministicMode()
+
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	// Wrapper flags are taken out before anything reads the arguments or the environment
+	args, err := parseWrapFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		os.Exit(2)
+	}
+	os.Args = append(os.Args[:1], args...)
+	// --wrap-deterministic only becomes known here
+	applyDeterministicMode()
+
+	// Serve from a recorded session without launching a browser
+	if fixturePath := os.Getenv("PLAYWRIGHTWRAP_FIXTURE"); fixturePath != "" {
+		os.Exit(runFixture(fixturePath))
+	}
+	os.Exit(runWrapper())
+}
 
-	// Ensure tmp directory exists
-	tmpDir := "./tmp"
-	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(tmpDir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create tmp directory: %v\n", err)
-			os.Exit(1)
+// runWrapper runs playwright with a private copy of the profile's storage state and
+// returns the exit code for the wrapper
+func runWrapper() int {
+	// Load the config and the selected profile
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	profile := profileName()
+	var grant *quotaGrant
+	if rotation := os.Getenv("PLAYWRIGHTWRAP_ROTATION"); rotation != "" {
+		profile, grant, err = selectProfile(config, rotation)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to select profile: %v\n", err)
+			return 1
+		}
+		// Whichever way the session ends, its reservation does not outlive it
+		defer grant.release()
+	}
+	profileConfig := config.Profile(profile)
+	if quarantine := quarantined(profile); quarantine != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: profile %s is quarantined after its child crashed %d times, last at %s\n", profile, quarantine.Crashes, quarantine.Since.Format(time.RFC3339))
+		if quarantine.Bundle != "" {
+			fmt.Fprintf(os.Stderr, "playwrightwrap: crash bundle: %s\n", quarantine.Bundle)
 		}
+		fmt.Fprintf(os.Stderr, "playwrightwrap: run `playwrightwrap profiles release %s` once the cause is fixed\n", profile)
+		return 1
+	}
+	if err := validateCompression(config.Compression); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	if err := validateLogFallback(config.LogFallback); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
 	}
+	installFlag, err := npxInstallFlag(config.NpxInstall)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	redactor, err := NewRedactor(config, profileConfig.Redaction)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+
+	// Source storage state file
+	storageStatePath := config.storageStatePath(profile)
+
+	// Create the session directory holding the temp copy, the log and the status file
+	session, err := NewSessionDir(profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create session directory: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := session.Close(config.KeepSessions); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to clean up session directory: %v\n", err)
+		}
+	}()
 
-	// Create a temporary file for the storage state in tmp directory
-	tempFile, err := os.CreateTemp(tmpDir, "storage_state_*.json")
+	// Create a temporary file for the storage state in the session directory
+	tempFilePath := session.Path(sessionStateFile)
+	tempFile, err := os.OpenFile(tempFilePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create temp file: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
-	tempFilePath := tempFile.Name()
 
-	// Create logger with log file path based on temp file name
-	logPath := tempFilePath + ".log"
-	logger := NewLogger(logPath)
+	// Create logger in the session directory
+	logPath := compressedPath(session.Path(sessionLogFile), config.Compression)
+	logger := NewLogger(logPath, config.LogFallback)
+	logger.redactor = redactor
 	defer logger.Close()
 
 	logger.Log("Program started")
 	logger.Log("Temp file created: %s", tempFilePath)
 	logger.Log("Original args: %v", os.Args[1:])
-
-	// Ensure temp file is cleaned up on exit
-	defer os.Remove(tempFilePath)
+	logger.Log("Profile: %s", profile)
 
 	// Copy the storage state to the temp file
-	sourceFile, err := os.Open(storageStatePath)
+	timer := NewStartupTimer(logger)
+	// Remember what the profile looked like, write-backs check nobody changed it meanwhile
+	stateChecksum, err := fileChecksum(storageStatePath)
+	if err != nil {
+		logger.Log("Failed to read %s: %v", storageStatePath, err)
+	}
+	data, layers, err := buildLayeredState(config, profile, logger)
 	if err != nil {
-		logger.Log("Failed to open storage state file: %v", err)
-		fmt.Fprintf(os.Stderr, "Failed to open storage state file %s: %v\n", storageStatePath, err)
-		os.Exit(1)
+		tempFile.Close()
+		logger.Log("Failed to read storage state file: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to read storage state file %s: %v\n", storageStatePath, err)
+		return 1
 	}
 
-	_, err = io.Copy(tempFile, sourceFile)
-	sourceFile.Close()
-	tempFile.Close()
+	timer.Mark(phaseSourceFetch)
+
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		// The session directory, with the partial copy, is removed on return
+		err = diskFull(err, tempFilePath)
 		logger.Log("Failed to copy storage state: %v", err)
 		fmt.Fprintf(os.Stderr, "Failed to copy storage state: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
+	timer.Mark(phaseCopy)
 	logger.Log("Storage state copied from %s to %s", storageStatePath, tempFilePath)
 
 	// Filter out --isolated and --storage-state from arguments
@@ -104,51 +250,491 @@ func main() {
 	logger.Log("Filtered args: %v", filteredArgs)
 
 	// Build the command arguments
-	args := []string{"@playwright/mcp", "--isolated", "--storage-state=" + tempFilePath}
+	args := []string{installFlag, config.mcpPackageSpec(), "--isolated", "--storage-state=" + tempFilePath}
+	if profileConfig.Browser != "" {
+		filteredArgs = removeFlag(filteredArgs, "--browser", true)
+		args = append(args, "--browser="+profileConfig.Browser)
+	}
+	if profileConfig.ExecutablePath != "" {
+		executable, err := validateExecutable(profileConfig.ExecutablePath)
+		if err != nil {
+			logger.Log("Invalid config: %v", err)
+			fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+			return 1
+		}
+		filteredArgs = removeFlag(filteredArgs, "--executable-path", true)
+		args = append(args, "--executable-path="+executable)
+	}
+
+	if len(profileConfig.Caps) > 0 {
+		caps, unknown := capsFlag(profileConfig.Caps)
+		if len(unknown) > 0 {
+			logger.Log("Unknown capabilities: %v", unknown)
+			fmt.Fprintf(os.Stderr, "playwrightwrap: warning: unknown capabilities %s, passing them on in case %s supports them (known: %s)\n",
+				strings.Join(unknown, ", "), config.mcpPackageSpec(), strings.Join(knownCaps, ", "))
+		}
+		filteredArgs = removeFlag(filteredArgs, "--caps", true)
+		args = append(args, "--caps="+caps)
+	}
+
+	// The configured network restrictions replace the client's, the URL policy checks
+	// navigations against the same origins
+	if profileConfig.Network != nil {
+		filteredArgs = removeFlag(filteredArgs, "--allowed-origins", true)
+		filteredArgs = removeFlag(filteredArgs, "--blocked-origins", true)
+		filteredArgs = removeFlag(filteredArgs, "--block-service-workers", false)
+		args = append(args, profileConfig.Network.flags()...)
+	}
+
+	// Route downloads into the managed directory
+	var downloads *DownloadTracker
+	if profileConfig.Downloads != nil {
+		downloads, err = NewDownloadTracker(profileConfig.Downloads, logger)
+		if err != nil {
+			logger.Log("Failed to prepare downloads directory: %v", err)
+			fmt.Fprintf(os.Stderr, "Failed to prepare downloads directory: %v\n", err)
+			return 1
+		}
+		filteredArgs = removeFlag(filteredArgs, "--output-dir", true)
+		args = append(args, "--output-dir="+downloads.Dir())
+		logger.Log("Managing downloads in %s", downloads.Dir())
+	}
 	args = append(args, filteredArgs...)
 	logger.Log("Final command: npx %v", args)
+	// The child's HTTP transport has no authentication of its own
+	if flagValue(args, "--port") != "" {
+		if host := flagValue(args, "--host"); host != "" {
+			warnExposed("the playwright child's HTTP transport", host)
+		}
+	}
+	env, envNames := config.childEnv(profile)
+	childSetup, err := config.childSettings(profile)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	if childSetup.dir != "" {
+		logger.Log("Child working directory: %s", childSetup.dir)
+	}
+	if childSetup.umask >= 0 {
+		if umaskSupported {
+			logger.Log("Child umask: %03o", childSetup.umask)
+		} else {
+			fmt.Fprintln(os.Stderr, "playwrightwrap: warning: the child umask is not supported on this platform and is ignored")
+		}
+	}
+	if len(envNames) > 0 {
+		logger.Log("Child environment sets: %v", envNames)
+	}
+
+	// Record the session if requested
+	var recorder *Recorder
+	if recordPath := os.Getenv("PLAYWRIGHTWRAP_RECORD"); recordPath != "" {
+		recordPath = compressedPath(recordPath, config.Compression)
+		recorder, err = NewRecorder(recordPath)
+		if err != nil {
+			logger.Log("Failed to create recording: %v", err)
+			fmt.Fprintf(os.Stderr, "Failed to create recording %s: %v\n", recordPath, err)
+			return 1
+		}
+		defer recorder.Close()
+		recorder.redactor = redactor
+		logger.Log("Recording session to %s", recordPath)
+	}
+	proxy := NewProxy(logger, recorder, os.Stdout)
+	proxy.timer = timer
+	proxy.downloads = downloads
+	proxy.redactor = redactor
+	proxy.budget = NewBudget(grant.budget(profileConfig.Budget))
+	grant.track(&proxy.stats)
+	proxy.cache = NewResponseCache(profileConfig.Cache)
+	proxy.validator = NewArgumentValidator(profileConfig.ValidateArguments)
+	proxy.auth, err = NewAuthDetector(profileConfig.AuthSignals)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	probe, err := newProbe(profileConfig.Probe)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	if profileConfig.History != nil {
+		if proxy.history, err = NewNavigationHistory(profileConfig.History, redactor); err != nil {
+			logger.Log("Invalid config: %v", err)
+			fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+			return 1
+		}
+	}
+	if profileConfig.ErrorCapture != nil {
+		if proxy.capture, err = NewErrorCapture(profileConfig.ErrorCapture, proxy, logger, session.status.ID); err != nil {
+			logger.Log("Failed to prepare error capture directory: %v", err)
+			fmt.Fprintf(os.Stderr, "Failed to prepare error capture directory: %v\n", err)
+			return 1
+		}
+	}
+	policies, err := newProxyPolicies(config, profileConfig, profileConfig.Network)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	proxy.policies.Store(policies)
+	reloader := NewConfigReloader(configPath(), profile, profileConfig.Network, proxy, logger)
+	if config.WatchConfig {
+		reloader.Watch()
+		defer reloader.Stop()
+	}
+	proxy.names, err = NewToolNamer(profileConfig.ToolPrefix, profileConfig.ToolRenames)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+
+	proxy.approvals, err = NewApprovals(profileConfig.Approval, logger)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	if proxy.approvals != nil {
+		proxy.approvals.redactor = redactor
+	}
 
-	// Create the command
-	cmd := exec.Command("npx", args...)
+	notifier, err := NewNotifier(config.Notifications, profile, logger)
+	if err != nil {
+		logger.Log("Invalid config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	if notifier != nil {
+		notifier.redactor = redactor
+	}
+	defer notifier.Wait()
 
-	// Redirect stdin, stdout, stderr
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Let other processes talk to the session
+	control, err := NewControlServer(session.Path(sessionSocketFile), logger)
+	if err != nil {
+		logger.Log("Control socket unavailable: %v", err)
+		if proxy.approvals != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create control socket for approvals: %v\n", err)
+			return 1
+		}
+	} else {
+		defer control.Close()
+		if proxy.approvals != nil {
+			proxy.approvals.register(control)
+		}
+		reloader.register(control)
+		control.Start()
+		logger.Log("Control socket: %s", control.Path())
+	}
+	// Events go to the control socket's subscribers and to the notification channels
+	events := eventSinks{control, notifier}
+	proxy.events = events
+	if proxy.approvals != nil {
+		proxy.approvals.events = events
+	}
+
+	// Write the live state back to the profile if configured
+	var checkpointer *Checkpointer
+	if profileConfig.Checkpoint != nil {
+		if profileConfig.Template {
+			logger.Log("Checkpointing is not supported for template profiles")
+			fmt.Fprintln(os.Stderr, "Invalid config: checkpoint cannot be used with template profiles, it would write expanded secrets back")
+			return 1
+		}
+		checkpointer, err = NewCheckpointer(profileConfig.Checkpoint, proxy, logger, tempFilePath, storageStatePath)
+		if err != nil {
+			logger.Log("Invalid config: %v", err)
+			fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+			return 1
+		}
+		checkpointer.profile, checkpointer.sessionID, checkpointer.baseline = profile, session.status.ID, stateChecksum
+		checkpointer.layers = layers
+	}
+
+	// Revoke the credentials when the lease runs out
+	if profileConfig.Lease != nil {
+		proxy.lease, err = NewLease(profileConfig.Lease, proxy, logger, tempFilePath)
+		if err != nil {
+			logger.Log("Invalid config: %v", err)
+			fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+			return 1
+		}
+		proxy.lease.checkpointer, proxy.lease.events = checkpointer, events
+		defer proxy.lease.Stop()
+	}
 
 	// Handle signals to forward them to the child process
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
+	// Let top save the state on request, through the checkpointer when there is one
+	if control != nil {
+		saver := checkpointer
+		if saver == nil && !profileConfig.Template {
+			saver, _ = NewCheckpointer(&CheckpointConfig{}, proxy, logger, tempFilePath, storageStatePath)
+			saver.profile, saver.sessionID, saver.baseline = profile, session.status.ID, stateChecksum
+			saver.layers = layers
+			saver.events = events
+		}
+		registerCallCommand(control, proxy)
+		registerSessionCommands(control, proxy, saver, func() {
+			select {
+			case sigChan <- syscall.SIGTERM:
+			default:
+			}
+		})
+	}
+
 	// Start the process
-	if err := cmd.Start(); err != nil {
+	timer.Mark(phaseSetup)
+	nodePath, nodeVersion, err := checkNode()
+	if err != nil {
+		logger.Log("Node.js check failed: %v", err)
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		return 1
+	}
+	logger.Log("Using Node.js %s at %s", nodeVersion, nodePath)
+	if _, err := exec.LookPath("npx"); err != nil {
+		logger.Log("npx not found: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to start playwright: %v\n", err)
+		return 1
+	}
+	timer.Mark(phaseNodeCheck)
+	// Fail fast when the profile has been signed out, before the agent spends a run
+	if probe != nil {
+		logger.Log("Probing %s for profile %s", probe.url, profile)
+		if err := probe.Run(args, env, childSetup, config.NpxInstall, logger); err != nil {
+			logger.Log("Probe failed: %v", err)
+			fmt.Fprintf(os.Stderr, "playwrightwrap: profile %s: %v\n", profile, err)
+			return 1
+		}
+		logger.Log("Probe found the profile authenticated")
+		timer.Mark(phaseProbe)
+	}
+	tail := &stderrTail{}
+	prompts := newPromptWatcher(config.NpxInstall, logger)
+	child, err := startChild(args, env, childSetup, tail, prompts)
+	if err != nil {
 		logger.Log("Failed to start playwright: %v", err)
 		fmt.Fprintf(os.Stderr, "Failed to start playwright: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	timer.Mark(phaseChildSpawn)
+	logger.Log("Playwright process started with PID: %d", child.cmd.Process.Pid)
+	// Record the environment so the session can be rerun under the same conditions
+	manifest := newSessionManifest(config, profile, args, env, envNames, nodePath, nodeVersion)
+	if err := manifest.save(session.Path(sessionManifestFile)); err != nil {
+		logger.Log("Failed to write session manifest: %v", err)
+	}
+	events.Publish(eventChildStarted, map[string]interface{}{"pid": child.cmd.Process.Pid, "profile": profile})
+	session.SetStatus(statusStarting, func(status *sessionStatus) { status.ChildPID = child.cmd.Process.Pid })
+	proxy.AttachChild(child.stdin)
+	prompts.setAnswer(proxy.child.Write)
+	var current atomic.Pointer[exec.Cmd]
+	current.Store(child.cmd)
+	if downloads != nil {
+		downloads.Start()
+	}
+	if checkpointer != nil {
+		checkpointer.events = events
+		checkpointer.Start()
 	}
-	logger.Log("Playwright process started with PID: %d", cmd.Process.Pid)
+	if proxy.lease != nil {
+		proxy.lease.Start()
+	}
+	go func() {
+		<-proxy.Ready()
+		events.Publish(eventHandshakeOK, map[string]interface{}{"elapsed": timer.Elapsed().String()})
+		manifest.MCPVersion = proxy.ServerVersion()
+		if err := manifest.save(session.Path(sessionManifestFile)); err != nil {
+			logger.Log("Failed to write session manifest: %v", err)
+		}
+		session.SetStatus(statusRunning, nil)
+	}()
+	var shutdown sync.Once
+	var stopping atomic.Bool
+	shuttingDown := func(reason string) {
+		stopping.Store(true)
+		shutdown.Do(func() {
+			events.Publish(eventShuttingDown, map[string]interface{}{"reason": reason})
+			session.SetStatus(statusExiting, nil)
+		})
+	}
+
+	// Relay messages in both directions
+	go func() {
+		if err := proxy.ServeClient(os.Stdin); err != nil {
+			logger.Log("Client stream error: %v", err)
+		}
+		shuttingDown("client disconnected")
+		// Save the final state while the browser is still around
+		if checkpointer != nil {
+			checkpointer.Stop()
+			if err := checkpointer.Save("session end"); err != nil {
+				logger.Log("Final state checkpoint failed: %v", err)
+			}
+		}
+		// Let captures of the last failures finish while the browser is still around
+		proxy.capture.Stop()
+		proxy.CloseChild()
+	}()
 
 	// Forward signals to child process
 	go func() {
 		for sig := range sigChan {
 			logger.Log("Received signal: %v, forwarding to child process", sig)
-			if cmd.Process != nil {
+			shuttingDown("received " + sig.String())
+			if cmd := current.Load(); cmd != nil && cmd.Process != nil {
 				cmd.Process.Signal(sig)
 			}
 		}
 	}()
 
-	// Wait for the process to finish
-	if err := cmd.Wait(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			logger.Log("Process exited with code: %d", exitError.ExitCode())
-			os.Exit(exitError.ExitCode())
+	exitCode := 0
+	fallbacks := offlineFallbacks
+	for {
+		if err := proxy.ServeChild(child.stdout); err != nil {
+			logger.Log("Child stream error: %v", err)
+		}
+
+		// Wait for the process to finish
+		exitCode = 0
+		if err := child.cmd.Wait(); err != nil {
+			if exitError, ok := err.(*exec.ExitError); ok {
+				logger.Log("Process exited with code: %d", exitError.ExitCode())
+				exitCode = exitError.ExitCode()
+			} else {
+				logger.Log("Process error: %v", err)
+				fmt.Fprintf(os.Stderr, "Process error: %v\n", err)
+				exitCode = 1
+			}
+		} else {
+			logger.Log("Process finished successfully")
+		}
+
+		// npx could not reach the registry before the server came up, try the npm cache
+		if exitCode == 0 || proxy.Spoke() || len(fallbacks) == 0 || !isRegistryFailure(tail.String()) {
+			break
+		}
+		for _, flag := range offlineFallbacks {
+			args = removeFlag(args, flag, false)
+		}
+		args = append([]string{fallbacks[0]}, args...)
+		fallbacks = fallbacks[1:]
+		logger.Log("npm registry unreachable, retrying with %s: npx %v", args[0], args)
+		fmt.Fprintf(os.Stderr, "playwrightwrap: npm registry unreachable, retrying with npx %s\n", args[0])
+		events.Publish(eventRestart, map[string]interface{}{"reason": "npm registry unreachable", "retryWith": args[0]})
+		tail.Reset()
+		if child, err = startChild(args, env, childSetup, tail, prompts); err != nil {
+			logger.Log("Failed to start playwright: %v", err)
+			fmt.Fprintf(os.Stderr, "Failed to start playwright: %v\n", err)
+			exitCode = 1
+			break
+		}
+		logger.Log("Playwright process started with PID: %d", child.cmd.Process.Pid)
+		events.Publish(eventChildStarted, map[string]interface{}{"pid": child.cmd.Process.Pid, "profile": profile})
+		session.SetStatus(statusStarting, func(status *sessionStatus) { status.ChildPID = child.cmd.Process.Pid })
+		current.Store(child.cmd)
+		proxy.AttachChild(child.stdin)
+		prompts.setAnswer(proxy.child.Write)
+	}
+
+	// A child that exits with an error on its own counts towards a crash loop
+	if exitCode != 0 && !stopping.Load() {
+		report := newCrashReport(profile, exitCode, args, envNames)
+		quarantine, err := recordCrash(config.CrashLoop, report, tail.String(), logPath)
+		events.Publish(eventCrash, map[string]interface{}{"exitCode": exitCode, "profile": profile})
+		if err != nil {
+			logger.Log("Failed to record crash: %v", err)
+		} else if quarantine != nil {
+			events.Publish(eventQuarantined, map[string]interface{}{"crashes": quarantine.Crashes, "bundle": quarantine.Bundle, "profile": profile})
+			logger.Log("Profile %s quarantined after %d crashes, bundle: %s", profile, quarantine.Crashes, quarantine.Bundle)
+			_, window := config.CrashLoop.limits()
+			fmt.Fprintf(os.Stderr, "playwrightwrap: the child of profile %s crashed %d times within %v; the profile is quarantined and will not start until `playwrightwrap profiles release %s`\n", profile, quarantine.Crashes, window, profile)
+			fmt.Fprintf(os.Stderr, "playwrightwrap: crash bundle: %s\n", quarantine.Bundle)
+		}
+	}
+	shuttingDown(fmt.Sprintf("child exited with code %d", exitCode))
+	session.SetStatus(statusExiting, func(status *sessionStatus) { status.ExitCode = &exitCode })
+
+	if exitCode != 0 {
+		for _, hint := range matchHints(tail.String()) {
+			logger.Log("Hint: %s", hint)
+			fmt.Fprintf(os.Stderr, "playwrightwrap hint: %s\n", hint)
+		}
+	}
+
+	summary := &SessionSummary{Profile: profile, DirtySignals: proxy.auth.Signals()}
+	summary.Checkpoints, summary.LastSaved = checkpointer.Stats()
+	summary.Startup = timer.Phases()
+	summary.BudgetExceeded, summary.BudgetRejected = proxy.budget.Exceeded()
+	summary.ErrorCaptures = proxy.capture.Stop()
+	summary.BytesFromClient, summary.BytesToClient = proxy.stats.bytesFromClient.Load(), proxy.stats.bytesToClient.Load()
+	summary.Traffic = proxy.stats.toolTraffic()
+	if downloads != nil {
+		summary.Downloads = downloads.Stop()
+	}
+	summary.Report(logger, os.Stderr)
+	if proxy.history != nil {
+		if path, err := proxy.history.Write(session.status.ID); err != nil {
+			logger.Log("Failed to write navigation history: %v", err)
+			fmt.Fprintf(os.Stderr, "playwrightwrap: failed to write navigation history: %v\n", err)
+		} else {
+			logger.Log("Navigation history written to %s", path)
+		}
+	}
+
+	utilization := -1.0
+	if grant != nil {
+		if utilization, err = grant.finish(); err != nil {
+			logger.Log("Failed to record quota usage: %v", err)
+			utilization = -1
+		} else {
+			logger.Log("Profile %s used %.0f%% of its quota", profile, utilization*100)
 		}
-		logger.Log("Process error: %v", err)
-		fmt.Fprintf(os.Stderr, "Process error: %v\n", err)
-		os.Exit(1)
 	}
-	logger.Log("Process finished successfully")
+
+	if config.Metrics != nil {
+		metrics := sessionMetrics(summary, &proxy.stats, exitCode, timer.Elapsed())
+		if utilization >= 0 {
+			metrics = append(metrics, metric{name: "quota_utilization_ratio", value: utilization})
+		}
+		if err := pushMetrics(config.Metrics, profile, metrics); err != nil {
+			logger.Log("Failed to push metrics: %v", err)
+			fmt.Fprintf(os.Stderr, "playwrightwrap: failed to push metrics: %v\n", err)
+		} else {
+			logger.Log("Pushed %d session metrics", len(metrics))
+		}
+	}
+	return exitCode
+}
+
+// runFixture answers MCP requests on stdio from a recorded session and returns the exit code
+func runFixture(path string) int {
+	logger := NewLogger(path+".log", "")
+	defer logger.Close()
+
+	fixture, err := LoadFixture(path, logger)
+	if err != nil {
+		logger.Log("Failed to load fixture: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to load fixture %s: %v\n", path, err)
+		return 1
+	}
+	logger.Log("Serving fixture %s", path)
+	if err := fixture.Serve(os.Stdin, os.Stdout); err != nil {
+		logger.Log("Fixture error: %v", err)
+		fmt.Fprintf(os.Stderr, "Fixture error: %v\n", err)
+		return 1
+	}
+	logger.Log("Fixture session finished")
+	return 0
 }
 
 // filterArgs removes --isolated and --storage-state arguments from the slice
@@ -189,6 +775,25 @@ func filterArgs(args []string) []string {
 	return result
 }
 
+// removeFlag removes every occurrence of a --name or --name=value argument. When
+// takesValue is set, a bare --name also consumes the argument following it.
+func removeFlag(args []string, name string, takesValue bool) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == name {
+			if takesValue {
+				i++
+			}
+			continue
+		}
+		if strings.HasPrefix(args[i], name+"=") {
+			continue
+		}
+		result = append(result, args[i])
+	}
+	return result
+}
+
 // getExecutableDir returns the directory where the executable is located
 func getExecutableDir() (string, error) {
 	executable, err := os.Executable()
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sessionManifestFile = "session-manifest.json"
+
+// sessionManifest records what a session ran with, so that it can be run again under the
+// same conditions
+type sessionManifest struct {
+	Created     time.Time `json:"created"`
+	Profile     string    `json:"profile"`
+	Wrapper     string    `json:"wrapper"`
+	OS          string    `json:"os"`
+	NodePath    string    `json:"nodePath"`
+	NodeVersion string    `json:"nodeVersion"`
+	NpxVersion  string    `json:"npxVersion,omitempty"`
+	// MCPVersion is the version the child reported, empty when it never initialized
+	MCPVersion string   `json:"mcpVersion,omitempty"`
+	Browsers   []string `json:"browsers,omitempty"`
+	WorkDir    string   `json:"workDir"`
+	// Args are the wrapper's arguments, ChildArgs what npx was started with
+	Args      []string `json:"args"`
+	ChildArgs []string `json:"childArgs"`
+	// Environment lists the names of the variables the config set for the child
+	Environment []string `json:"environment,omitempty"`
+	// Config is the session's config without its secrets: environment values are blanked
+	// and notifications and metrics left out. ConfigDigest is the hash of the full config.
+	Config       *Config `json:"config"`
+	ConfigDigest string  `json:"configDigest"`
+}
+
+// newSessionManifest collects the versions of the session's environment
+func newSessionManifest(config *Config, profile string, childArgs []string, env []string, envNames []string, nodePath, nodeVersion string) *sessionManifest {
+	manifest := &sessionManifest{
+		Created:     clockNow(),
+		Profile:     profile,
+		Wrapper:     wrapperVersion(),
+		OS:          runtime.GOOS + "/" + runtime.GOARCH,
+		NodePath:    nodePath,
+		NodeVersion: nodeVersion,
+		NpxVersion:  npxVersion(),
+		Browsers:    installedBrowsers(env),
+		Args:        os.Args[1:],
+		ChildArgs:   childArgs,
+		Environment: envNames,
+	}
+	manifest.Config, manifest.ConfigDigest = manifestConfig(config)
+	manifest.WorkDir, _ = os.Getwd()
+	return manifest
+}
+
+// configDigest hashes the config as it is saved
+func configDigest(config *Config) string {
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// manifestConfig returns a copy of config fit for the manifest, and the full config's digest
+func manifestConfig(config *Config) (*Config, string) {
+	data, _ := json.Marshal(config)
+	stripped := &Config{}
+	json.Unmarshal(data, stripped)
+	stripped.Notifications, stripped.Metrics = nil, nil
+	blankVars(stripped.Environment)
+	for _, profile := range stripped.Profiles {
+		if profile != nil {
+			blankVars(profile.Environment)
+		}
+	}
+	return stripped, configDigest(config)
+}
+
+// blankVars keeps the names of the variables and drops their values
+func blankVars(environment *EnvironmentConfig) {
+	if environment == nil {
+		return
+	}
+	for name := range environment.Vars {
+		environment.Vars[name] = ""
+	}
+}
+
+// fillVars takes the values of the blanked variables from the current config. A
+// variable the current config no longer sets is dropped with a warning.
+func fillVars(environment, current *EnvironmentConfig, where string) {
+	if environment == nil {
+		return
+	}
+	for name, value := range environment.Vars {
+		if value != "" {
+			continue
+		}
+		if current != nil {
+			if value, ok := current.Vars[name]; ok {
+				environment.Vars[name] = value
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %s variable %s is not in the current config, rerunning without it\n", where, name)
+		delete(environment.Vars, name)
+	}
+}
+
+// save writes the manifest to path
+func (m *sessionManifest) save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// loadManifest reads a session manifest
+func loadManifest(path string) (*sessionManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid session manifest %s: %v", path, err)
+	}
+	if manifest.Config == nil {
+		manifest.Config = &Config{}
+	}
+	return manifest, nil
+}
+
+// wrapperVersion returns the wrapper's module version and the Go version it was built with
+func wrapperVersion() string {
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	return version + " " + runtime.Version()
+}
+
+// npxVersion returns the version of npx in PATH, "" if it cannot be run
+func npxVersion() string {
+	out, err := exec.Command("npx", "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// installedBrowsers lists the browser builds Playwright has downloaded
+func installedBrowsers(env []string) []string {
+	dir := browsersDir(env)
+	if dir == "" {
+		return nil
+	}
+	entries, _ := os.ReadDir(dir)
+	var browsers []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			browsers = append(browsers, entry.Name())
+		}
+	}
+	return browsers
+}
+
+// runRerun implements "playwrightwrap rerun <manifest>", running the wrapper again with
+// the config, profile, arguments and @playwright/mcp version of a recorded session
+func runRerun(args []string) int {
+	flags := flag.NewFlagSet("rerun", flag.ContinueOnError)
+	strict := flags.Bool("strict", false, "refuse to run when Node.js, npx, the browsers or the config differ from the manifest")
+	acceptConfig := flags.Bool("accept-config", false, "run a manifest that passes the child arguments or sets settings that run code, place files or change what the session may do")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap rerun [--strict] [--accept-config] <session-manifest.json>")
+		return 2
+	}
+	manifest, err := loadManifest(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read manifest: %v\n", err)
+		return 1
+	}
+
+	// A manifest may come from someone else; what it runs is shown before it runs. The
+	// wrapper's own flags would override the config under review, a session never
+	// records them.
+	if err := checkProfileName(manifest.Profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid manifest: %v\n", err)
+		return 1
+	}
+	for _, arg := range manifest.Args {
+		if strings.HasPrefix(arg, wrapFlagPrefix) {
+			fmt.Fprintf(os.Stderr, "Invalid manifest: its arguments include the wrapper flag %s\n", arg)
+			return 1
+		}
+	}
+	held := manifest.Config.Profile(manifest.Profile).privilegedSettings()
+	if len(manifest.Args) > 0 {
+		held["child arguments"] = manifest.Args
+	}
+	if manifest.Config.Environment != nil {
+		held["top-level environment"] = manifest.Config.Environment
+	}
+	if manifest.Config.Child != nil {
+		held["top-level child"] = manifest.Config.Child
+	}
+	if len(held) > 0 {
+		names := make([]string, 0, len(held))
+		for field := range held {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+		for _, field := range names {
+			data, _ := json.Marshal(held[field])
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", field, data)
+		}
+		if !*acceptConfig {
+			fmt.Fprintf(os.Stderr, "playwrightwrap: the manifest sets %s above, which can run code, place files or change what the session may do; review them and pass --accept-config to rerun\n", strings.Join(names, ", "))
+			return 1
+		}
+	}
+
+	// The manifest holds no variable values, they come from the current config
+	current, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	fillVars(manifest.Config.Environment, current.Environment, "top-level")
+	if profile := manifest.Config.Profiles[manifest.Profile]; profile != nil {
+		fillVars(profile.Environment, current.Profile(manifest.Profile).Environment, "profile")
+	}
+
+	// The manifest's config carries the environment, compare what it resolves to now
+	env, _ := manifest.Config.childEnv(manifest.Profile)
+	_, nodeVersion, _ := checkNode()
+	var differences []string
+	if nodeVersion != manifest.NodeVersion {
+		differences = append(differences, fmt.Sprintf("Node.js is %s, the session ran %s", orNone(nodeVersion), manifest.NodeVersion))
+	}
+	if version := npxVersion(); manifest.NpxVersion != "" && version != manifest.NpxVersion {
+		differences = append(differences, fmt.Sprintf("npx is %s, the session ran %s", orNone(version), manifest.NpxVersion))
+	}
+	installed := make(map[string]bool)
+	for _, browser := range installedBrowsers(env) {
+		installed[browser] = true
+	}
+	for _, browser := range manifest.Browsers {
+		if !installed[browser] {
+			differences = append(differences, fmt.Sprintf("browser build %s is not installed", browser))
+		}
+	}
+	if manifest.ConfigDigest != "" && configDigest(current) != manifest.ConfigDigest {
+		differences = append(differences, "the config has changed since the session ran")
+	}
+	if wrapper := wrapperVersion(); wrapper != manifest.Wrapper {
+		differences = append(differences, fmt.Sprintf("the wrapper is %s, the session ran %s", wrapper, manifest.Wrapper))
+	}
+	for _, difference := range differences {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %s\n", difference)
+	}
+	if *strict && len(differences) > 0 {
+		fmt.Fprintln(os.Stderr, "playwrightwrap: the environment differs from the manifest, not running with --strict")
+		return 1
+	}
+
+	// Pin the package version the session ran, unless its config already pinned one
+	config := manifest.Config
+	if config.MCPVersion == "" {
+		config.MCPVersion = manifest.MCPVersion
+	}
+	// The wrapper runs in the session's working directory, the config path must not be relative
+	stateDir, err := filepath.Abs(sessionTmpDir())
+	if err == nil {
+		err = os.MkdirAll(stateDir, 0700)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create state directory: %v\n", err)
+		return 1
+	}
+	configFile, err := createTemp(stateDir, "rerun-*.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write config: %v\n", err)
+		return 1
+	}
+	configFile.Close()
+	defer os.Remove(configFile.Name())
+	if err := config.save(configFile.Name()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write config: %v\n", err)
+		return 1
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the wrapper executable: %v\n", err)
+		return 1
+	}
+	cmd := exec.Command(self, manifest.Args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if info, err := os.Stat(manifest.WorkDir); err == nil && info.IsDir() {
+		cmd.Dir = manifest.WorkDir
+	}
+	cmd.Env = []string{"PLAYWRIGHTWRAP_CONFIG=" + configFile.Name(), "PLAYWRIGHTWRAP_PROFILE=" + manifest.Profile}
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, "PLAYWRIGHTWRAP_CONFIG=") && !strings.HasPrefix(variable, "PLAYWRIGHTWRAP_PROFILE=") && !strings.HasPrefix(variable, "PLAYWRIGHTWRAP_ROTATION=") {
+			cmd.Env = append(cmd.Env, variable)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "playwrightwrap: rerunning profile %s with %s@%s\n", manifest.Profile, mcpPackage, orNone(config.MCPVersion))
+	err = cmd.Run()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run the wrapper: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,62 @@
+package main
+
+// cookieKey identifies a cookie the way browsers do, by name, domain and path
+type cookieKey struct {
+	name, domain, path string
+}
+
+// mergeStorageState merges incoming into base and returns the result. Cookies are
+// matched by name, domain and path, origins by origin and localStorage entries by
+// name; values from incoming win, everything else from base is kept in order.
+func mergeStorageState(base *StorageState, incoming *StorageState) *StorageState {
+	merged := &StorageState{}
+
+	cookieIndex := make(map[cookieKey]int)
+	for _, cookies := range [][]Cookie{base.Cookies, incoming.Cookies} {
+		for _, cookie := range cookies {
+			key := cookieKey{cookie.Name, cookie.Domain, cookie.Path}
+			if i, ok := cookieIndex[key]; ok {
+				merged.Cookies[i] = cookie
+				continue
+			}
+			cookieIndex[key] = len(merged.Cookies)
+			merged.Cookies = append(merged.Cookies, cookie)
+		}
+	}
+
+	originIndex := make(map[string]int)
+	for _, origins := range [][]OriginState{base.Origins, incoming.Origins} {
+		for _, origin := range origins {
+			i, ok := originIndex[origin.Origin]
+			if !ok {
+				originIndex[origin.Origin] = len(merged.Origins)
+				merged.Origins = append(merged.Origins, OriginState{Origin: origin.Origin})
+				i = len(merged.Origins) - 1
+			}
+			target := &merged.Origins[i]
+			target.LocalStorage = mergeLocalStorage(target.LocalStorage, origin.LocalStorage)
+			if len(origin.IndexedDB) > 0 {
+				target.IndexedDB = origin.IndexedDB
+			}
+		}
+	}
+	return merged
+}
+
+// mergeLocalStorage merges localStorage entries, entries from incoming win
+func mergeLocalStorage(base []NameValue, incoming []NameValue) []NameValue {
+	merged := append([]NameValue(nil), base...)
+	index := make(map[string]int)
+	for i, entry := range merged {
+		index[entry.Name] = i
+	}
+	for _, entry := range incoming {
+		if i, ok := index[entry.Name]; ok {
+			merged[i] = entry
+			continue
+		}
+		index[entry.Name] = len(merged)
+		merged = append(merged, entry)
+	}
+	return merged
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMetricsJob     = "playwrightwrap"
+	defaultMetricsPrefix  = "playwrightwrap"
+	defaultMetricsTimeout = 5 * time.Second
+)
+
+// MetricsConfig pushes the final metrics of each session, since sessions rarely live
+// long enough to be scraped
+type MetricsConfig struct {
+	// Pushgateway is the base URL of a Prometheus Pushgateway, such as http://localhost:9091
+	Pushgateway string `json:"pushgateway,omitempty"`
+	// Job is the Pushgateway job label, playwrightwrap by default
+	Job string `json:"job,omitempty"`
+	// StatsD is the host:port of a StatsD server, reached over UDP
+	StatsD string `json:"statsd,omitempty"`
+	// Prefix starts every StatsD metric name, playwrightwrap by default
+	Prefix string `json:"prefix,omitempty"`
+	// Timeout bounds each push, 5s by default
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// proxyStats counts what went through the proxy
+type proxyStats struct {
+	toolCalls      atomic.Int64
+	toolErrors     atomic.Int64
+	toolRejections atomic.Int64
+	cacheHits      atomic.Int64
+	navigations    atomic.Int64
+	// pageURL is the page the last tool result reported
+	pageURL atomic.Pointer[string]
+	// bytesFromClient and bytesToClient count the messages in each direction
+	bytesFromClient atomic.Int64
+	bytesToClient   atomic.Int64
+
+	trafficMu sync.Mutex
+	traffic   map[string]*toolTraffic
+}
+
+// toolTraffic is the size of one tool's calls and of the child's responses to them
+type toolTraffic struct {
+	Tool          string `json:"tool"`
+	RequestBytes  int64  `json:"requestBytes"`
+	ResponseBytes int64  `json:"responseBytes"`
+}
+
+// addTraffic counts bytes of a tool's calls and responses
+func (s *proxyStats) addTraffic(tool string, request, response int) {
+	s.trafficMu.Lock()
+	defer s.trafficMu.Unlock()
+	if s.traffic == nil {
+		s.traffic = make(map[string]*toolTraffic)
+	}
+	traffic := s.traffic[tool]
+	if traffic == nil {
+		traffic = &toolTraffic{Tool: tool}
+		s.traffic[tool] = traffic
+	}
+	traffic.RequestBytes += int64(request)
+	traffic.ResponseBytes += int64(response)
+}
+
+// toolTraffic returns the traffic of each tool, the largest first
+func (s *proxyStats) toolTraffic() []toolTraffic {
+	s.trafficMu.Lock()
+	defer s.trafficMu.Unlock()
+	traffic := make([]toolTraffic, 0, len(s.traffic))
+	for _, t := range s.traffic {
+		traffic = append(traffic, *t)
+	}
+	sort.Slice(traffic, func(i, j int) bool {
+		a, b := traffic[i].RequestBytes+traffic[i].ResponseBytes, traffic[j].RequestBytes+traffic[j].ResponseBytes
+		if a != b {
+			return a > b
+		}
+		return traffic[i].Tool < traffic[j].Tool
+	})
+	return traffic
+}
+
+// metric is one value pushed at the end of a session
+type metric struct {
+	name string
+	// phase labels startup phase durations, tool per-tool counters
+	phase   string
+	tool    string
+	value   float64
+	counter bool
+}
+
+// sessionMetrics collects the metrics of a finished session
+func sessionMetrics(summary *SessionSummary, stats *proxyStats, exitCode int, duration time.Duration) []metric {
+	rejected := 0
+	for _, d := range summary.Downloads {
+		if d.Rejected {
+			rejected++
+		}
+	}
+	metrics := []metric{
+		{name: "session_duration_seconds", value: duration.Seconds()},
+		{name: "session_exit_code", value: float64(exitCode)},
+		{name: "tool_calls_total", value: float64(stats.toolCalls.Load()), counter: true},
+		{name: "tool_errors_total", value: float64(stats.toolErrors.Load()), counter: true},
+		{name: "tool_calls_rejected_total", value: float64(stats.toolRejections.Load()), counter: true},
+		{name: "tool_calls_cached_total", value: float64(stats.cacheHits.Load()), counter: true},
+		{name: "navigations_total", value: float64(stats.navigations.Load()), counter: true},
+		{name: "downloads_total", value: float64(len(summary.Downloads)), counter: true},
+		{name: "downloads_rejected_total", value: float64(rejected), counter: true},
+		{name: "checkpoints_total", value: float64(summary.Checkpoints), counter: true},
+		{name: "state_dirty_signals_total", value: float64(len(summary.DirtySignals)), counter: true},
+	}
+	for _, phase := range summary.Startup {
+		metrics = append(metrics, metric{name: "startup_phase_seconds", phase: phase.Name, value: phase.Duration.Seconds()})
+	}
+	metrics = append(metrics,
+		metric{name: "client_received_bytes_total", value: float64(stats.bytesFromClient.Load()), counter: true},
+		metric{name: "client_sent_bytes_total", value: float64(stats.bytesToClient.Load()), counter: true})
+	for _, traffic := range stats.toolTraffic() {
+		metrics = append(metrics,
+			metric{name: "tool_request_bytes_total", tool: traffic.Tool, value: float64(traffic.RequestBytes), counter: true},
+			metric{name: "tool_response_bytes_total", tool: traffic.Tool, value: float64(traffic.ResponseBytes), counter: true})
+	}
+	return metrics
+}
+
+// pushMetrics sends the metrics to every configured endpoint
+func pushMetrics(config *MetricsConfig, profile string, metrics []metric) error {
+	timeout := time.Duration(config.Timeout)
+	if timeout == 0 {
+		timeout = defaultMetricsTimeout
+	}
+	var errs []error
+	if config.Pushgateway != "" {
+		if err := pushToGateway(config, profile, metrics, timeout); err != nil {
+			errs = append(errs, fmt.Errorf("pushgateway: %v", err))
+		}
+	}
+	if config.StatsD != "" {
+		if err := sendToStatsD(config, profile, metrics, timeout); err != nil {
+			errs = append(errs, fmt.Errorf("statsd: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushToGateway replaces the metrics of the job and profile group in the Pushgateway
+func pushToGateway(config *MetricsConfig, profile string, metrics []metric, timeout time.Duration) error {
+	job := config.Job
+	if job == "" {
+		job = defaultMetricsJob
+	}
+	var body bytes.Buffer
+	typed := map[string]bool{}
+	for _, m := range metrics {
+		name := "playwrightwrap_" + m.name
+		if !typed[name] {
+			typed[name] = true
+			kind := "gauge"
+			if m.counter {
+				kind = "counter"
+			}
+			fmt.Fprintf(&body, "# TYPE %s %s\n", name, kind)
+		}
+		if m.phase != "" {
+			fmt.Fprintf(&body, "%s{phase=%q} %g\n", name, m.phase, m.value)
+		} else if m.tool != "" {
+			fmt.Fprintf(&body, "%s{tool=%q} %g\n", name, m.tool, m.value)
+		} else {
+			fmt.Fprintf(&body, "%s %g\n", name, m.value)
+		}
+	}
+
+	target := strings.TrimRight(config.Pushgateway, "/") + "/metrics/job/" + url.PathEscape(job) + "/profile/" + url.PathEscape(profile)
+	request, err := http.NewRequest(http.MethodPut, target, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	response, err := (&http.Client{Timeout: timeout}).Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", target, response.Status)
+	}
+	return nil
+}
+
+var statsdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// sendToStatsD writes the metrics as StatsD lines in one UDP datagram; durations are
+// sent as timers in milliseconds
+func sendToStatsD(config *MetricsConfig, profile string, metrics []metric, timeout time.Duration) error {
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = defaultMetricsPrefix
+	}
+	prefix += "." + statsdUnsafe.ReplaceAllString(profile, "_")
+	var lines []string
+	for _, m := range metrics {
+		timing := !m.counter && strings.HasSuffix(m.name, "_seconds")
+		name := prefix + "." + strings.TrimSuffix(m.name, "_seconds")
+		if m.phase != "" {
+			name += "." + statsdUnsafe.ReplaceAllString(m.phase, "_")
+		}
+		if m.tool != "" {
+			name += "." + statsdUnsafe.ReplaceAllString(m.tool, "_")
+		}
+		switch {
+		case m.counter:
+			lines = append(lines, fmt.Sprintf("%s:%g|c", name, m.value))
+		case timing:
+			lines = append(lines, fmt.Sprintf("%s:%g|ms", name, m.value*1000))
+		default:
+			lines = append(lines, fmt.Sprintf("%s:%g|g", name, m.value))
+		}
+	}
+
+	conn, err := net.DialTimeout("udp", config.StatsD, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(lines, "\n")))
+	return err
+}
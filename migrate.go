@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// profileUnsafe matches characters that do not belong in a profile name
+var profileUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// checkProfileName refuses a profile name that would not stay inside the profiles
+// directory, such as one from a bundle made elsewhere
+func checkProfileName(name string) error {
+	if name == "." || name == ".." || profileUnsafe.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// migratedServer is a raw @playwright/mcp entry converted to a wrapper profile
+type migratedServer struct {
+	server  string
+	profile string
+	config  *ProfileConfig
+	version string
+	// args are the flags the wrapper passes on to the child unchanged
+	args []string
+	// persistent is set when the server kept its sessions in a browser profile rather
+	// than running --isolated, userDataDir when it named that profile's directory
+	persistent  bool
+	userDataDir string
+}
+
+// runMigrate implements "playwrightwrap migrate", converting the npx @playwright/mcp
+// entries of an MCP client config into wrapper profiles and pointing them at the wrapper
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := flags.String("from", "", "MCP client config to migrate, such as claude_desktop_config.json or .vscode/mcp.json (required)")
+	dryRun := flags.Bool("dry-run", false, "show what would change without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *from == "" || flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap migrate --from <client config> [--dry-run]")
+		return 2
+	}
+
+	original, err := os.ReadFile(*from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", *from, err)
+		return 1
+	}
+	document := make(map[string]interface{})
+	if err := json.Unmarshal(original, &document); err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not valid JSON: %v\n", *from, err)
+		return 1
+	}
+	path := configPath()
+	config, err := LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the wrapper executable: %v\n", err)
+		return 1
+	}
+
+	var migrated []*migratedServer
+	for _, key := range mcpServerKeys() {
+		servers, _ := document[key].(map[string]interface{})
+		names := make([]string, 0, len(servers))
+		for name := range servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entry, _ := servers[name].(map[string]interface{})
+			m := migrateServer(name, entry)
+			if m == nil {
+				continue
+			}
+			if existing, ok := config.Profiles[m.profile]; ok && existing != nil {
+				fmt.Fprintf(os.Stderr, "Skipping server %s: profile %s already exists in %s\n", name, m.profile, path)
+				continue
+			}
+			// mcpVersion applies to every profile, so one server's pin does not become it
+			if m.version != "" && config.MCPVersion == "" {
+				fmt.Fprintf(os.Stderr, "Warning: server %s pins %s %s, but the version is not pinned per profile and sessions use the latest; set mcpVersion in %s to pin it for all profiles\n", name, mcpPackage, m.version, path)
+			} else if m.version != "" && m.version != config.MCPVersion {
+				fmt.Fprintf(os.Stderr, "Warning: server %s pins %s %s, but sessions use %s\n", name, mcpPackage, m.version, config.MCPVersion)
+			}
+			if config.Profiles == nil {
+				config.Profiles = make(map[string]*ProfileConfig)
+			}
+			config.Profiles[m.profile] = m.config
+
+			// Keep the entry's other settings, such as its transport type and environment
+			env, _ := entry["env"].(map[string]interface{})
+			if env == nil {
+				env = make(map[string]interface{})
+			}
+			env["PLAYWRIGHTWRAP_PROFILE"] = m.profile
+			entry["command"] = self
+			entry["args"] = m.args
+			entry["env"] = env
+			migrated = append(migrated, m)
+		}
+	}
+	if len(migrated) == 0 {
+		fmt.Fprintf(os.Stderr, "No npx %s servers to migrate in %s\n", mcpPackage, *from)
+		return 0
+	}
+
+	for _, m := range migrated {
+		fmt.Fprintf(os.Stderr, "Server %s -> profile %s (storage state %s)", m.server, m.profile, config.storageStatePath(m.profile))
+		if len(m.args) > 0 {
+			fmt.Fprintf(os.Stderr, ", passing %s", strings.Join(m.args, " "))
+		}
+		fmt.Fprintln(os.Stderr)
+		// The wrapper runs the child isolated, a persistent profile's logins stay behind
+		if m.persistent {
+			browserProfile := "<the server's browser profile>"
+			if m.userDataDir != "" {
+				dir, err := filepath.Abs(m.userDataDir)
+				if err != nil {
+					dir = m.userDataDir
+				}
+				browserProfile = filepath.Join(dir, "Default")
+			}
+			fmt.Fprintf(os.Stderr, "Warning: server %s kept its logins in a persistent browser profile, which the wrapper does not use; bring its cookies over with\n  playwrightwrap import chrome --browser-profile %s --profile %s\n", m.server, browserProfile, m.profile)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Rewriting %s sorts its keys and indents it by two spaces, the rest of its content stays as it is\n", *from)
+	if *dryRun {
+		fmt.Fprintln(os.Stderr, "Dry run, nothing written")
+		return 0
+	}
+
+	for _, m := range migrated {
+		statePath := config.storageStatePath(m.profile)
+		if _, err := os.Stat(statePath); os.IsNotExist(err) {
+			if err := (&StorageState{}).save(statePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write storage state %s: %v\n", statePath, err)
+				return 1
+			}
+		}
+	}
+	if err := config.save(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write config %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Saved %s\n", path)
+
+	backup := *from + ".bak"
+	if err := os.WriteFile(backup, original, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to back up %s: %v\n", *from, err)
+		return 1
+	}
+	// The client config keeps its mode, the client may need to read it as another user
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(*from); err == nil {
+		mode = info.Mode().Perm()
+	}
+	// Keep &, < and > in arguments as they are written
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode %s: %v\n", *from, err)
+		return 1
+	}
+	if err := writeFileAtomic(*from, data.Bytes(), mode); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", *from, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Rewrote %d server(s) in %s, the original is in %s; restart the client to pick them up\n", len(migrated), *from, backup)
+	return 0
+}
+
+// mcpServerKeys are the objects of the known clients' configs that hold servers
+func mcpServerKeys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, client := range mcpClients {
+		if !seen[client.key] {
+			seen[client.key] = true
+			keys = append(keys, client.key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// migrateServer converts an entry running npx @playwright/mcp, or returns nil for any
+// other server. Following registerClient, server playwright becomes the default profile
+// and playwright-<name> profile <name>.
+func migrateServer(name string, entry map[string]interface{}) *migratedServer {
+	if entry == nil {
+		return nil
+	}
+	command, _ := entry["command"].(string)
+	words := []string{command}
+	rawArgs, _ := entry["args"].([]interface{})
+	for _, arg := range rawArgs {
+		s, ok := arg.(string)
+		if !ok {
+			return nil
+		}
+		words = append(words, s)
+	}
+	// Find npx, which may be run through a shell such as cmd /c on Windows
+	start := -1
+	for i, word := range words {
+		base := strings.ToLower(filepath.Base(word))
+		if base == "npx" || base == "npx.cmd" {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	m := &migratedServer{server: name, config: &ProfileConfig{}, persistent: true}
+	found := false
+	for i := start; i < len(words); i++ {
+		word := words[i]
+		if !found {
+			if word == mcpPackage || strings.HasPrefix(word, mcpPackage+"@") {
+				found = true
+				if version := strings.TrimPrefix(word, mcpPackage+"@"); version != word && version != "latest" {
+					m.version = version
+				}
+			}
+			// Anything before the package are npx's own flags, the wrapper sets those
+			continue
+		}
+		flag, value, hasValue := strings.Cut(word, "=")
+		takeValue := func() string {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(words) {
+				i++
+				return words[i]
+			}
+			return ""
+		}
+		switch flag {
+		case "--isolated":
+			// The wrapper always runs the child isolated
+			m.persistent = false
+		case "--user-data-dir":
+			m.userDataDir = takeValue()
+		case "--storage-state":
+			m.config.StorageState = takeValue()
+		case "--browser":
+			m.config.Browser = takeValue()
+		case "--executable-path":
+			m.config.ExecutablePath = takeValue()
+		default:
+			m.args = append(m.args, word)
+		}
+	}
+	if !found {
+		return nil
+	}
+	if m.args == nil {
+		m.args = []string{}
+	}
+	switch {
+	case name == "playwright":
+		m.profile = defaultProfileName
+	case strings.HasPrefix(name, "playwright-"):
+		m.profile = strings.TrimPrefix(name, "playwright-")
+	default:
+		m.profile = name
+	}
+	m.profile = strings.Trim(profileUnsafe.ReplaceAllString(m.profile, "-"), "-")
+	if m.profile == "" {
+		m.profile = defaultProfileName
+	}
+	return m
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// NetworkConfig sets the child's network restrictions. The wrapper checks navigations
+// against the same origins, so a blocked page fails with a clear error instead of a
+// browser network error.
+type NetworkConfig struct {
+	// AllowedOrigins are the only origins the browser may request, such as https://example.com
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	// BlockedOrigins may not be requested; they win over AllowedOrigins
+	BlockedOrigins []string `json:"blockedOrigins,omitempty"`
+	// BlockServiceWorkers keeps pages from registering service workers
+	BlockServiceWorkers bool `json:"blockServiceWorkers,omitempty"`
+}
+
+// flags returns the child's network flags
+func (n *NetworkConfig) flags() []string {
+	if n == nil {
+		return nil
+	}
+	var flags []string
+	if len(n.AllowedOrigins) > 0 {
+		flags = append(flags, "--allowed-origins="+strings.Join(n.AllowedOrigins, ";"))
+	}
+	if len(n.BlockedOrigins) > 0 {
+		flags = append(flags, "--blocked-origins="+strings.Join(n.BlockedOrigins, ";"))
+	}
+	if n.BlockServiceWorkers {
+		flags = append(flags, "--block-service-workers")
+	}
+	return flags
+}
+
+// URLPolicy decides which pages the client may navigate to, from the child's origins and
+// the policy's denyURLs
+type URLPolicy struct {
+	allowed map[string]bool
+	blocked map[string]bool
+	deny    []*regexp.Regexp
+}
+
+// NewURLPolicy validates the network config against the policy and creates the URL
+// policy, or returns nil when navigation is not restricted. Settings that contradict
+// each other are errors.
+func NewURLPolicy(network *NetworkConfig, policy *PolicyConfig) (*URLPolicy, error) {
+	p := &URLPolicy{allowed: make(map[string]bool), blocked: make(map[string]bool)}
+	if policy != nil {
+		for _, pattern := range policy.DenyURLs {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid denyURLs pattern %q: %v", pattern, err)
+			}
+			p.deny = append(p.deny, re)
+		}
+	}
+	if network != nil {
+		for _, origin := range network.BlockedOrigins {
+			normalized, err := parseOrigin(origin)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blockedOrigins entry: %v", err)
+			}
+			p.blocked[normalized] = true
+		}
+		for _, origin := range network.AllowedOrigins {
+			normalized, err := parseOrigin(origin)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowedOrigins entry: %v", err)
+			}
+			if p.blocked[normalized] {
+				return nil, fmt.Errorf("origin %s is both in allowedOrigins and blockedOrigins", origin)
+			}
+			for _, re := range p.deny {
+				if re.MatchString(normalized) || re.MatchString(normalized+"/") {
+					return nil, fmt.Errorf("origin %s is in allowedOrigins but denyURLs pattern %q blocks the origin itself", origin, re.String())
+				}
+			}
+			p.allowed[normalized] = true
+		}
+	}
+	if len(p.allowed) == 0 && len(p.blocked) == 0 && len(p.deny) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// Check returns why a navigation to rawURL is blocked, or "" if it is allowed. A nil
+// policy allows everything.
+func (p *URLPolicy) Check(rawURL string) string {
+	if p == nil || rawURL == "" {
+		return ""
+	}
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		origin := strings.ToLower(parsed.Scheme + "://" + parsed.Host)
+		if p.blocked[origin] {
+			return fmt.Sprintf("navigation to %s is blocked, %s is in the blockedOrigins of this session", rawURL, origin)
+		}
+		if len(p.allowed) > 0 && !p.allowed[origin] {
+			return fmt.Sprintf("navigation to %s is blocked, %s is not in the allowedOrigins of this session", rawURL, origin)
+		}
+	}
+	for _, re := range p.deny {
+		if re.MatchString(rawURL) {
+			return fmt.Sprintf("navigation to %s is blocked by the denyURLs pattern %q of this session", rawURL, re.String())
+		}
+	}
+	return ""
+}
+
+// parseOrigin checks that origin is scheme://host[:port] and returns it in lower case
+func parseOrigin(origin string) (string, error) {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("%q is not an origin, expected scheme://host[:port]", origin)
+	}
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" || strings.Contains(origin, ";") {
+		return "", fmt.Errorf("%q is not an origin, it must not have a path, query or semicolon", origin)
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host), nil
+}
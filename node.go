@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// minNodeMajor is the oldest Node.js major version @playwright/mcp supports
+const minNodeMajor = 18
+
+// checkNode finds Node.js and verifies its version is supported. It returns the
+// location and version of the node binary.
+func checkNode() (string, string, error) {
+	path, err := exec.LookPath("node")
+	if err != nil {
+		return "", "", fmt.Errorf("Node.js was not found in PATH; %s requires Node.js %d or newer", mcpPackage, minNodeMajor)
+	}
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return path, "", fmt.Errorf("failed to run %s --version: %v", path, err)
+	}
+	version := strings.TrimSpace(string(out))
+	major, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0])
+	if err != nil {
+		return path, version, fmt.Errorf("unrecognized Node.js version %q from %s", version, path)
+	}
+	if major < minNodeMajor {
+		return path, version, fmt.Errorf("Node.js %s found at %s is too old, %s requires Node.js %d or newer", version, path, mcpPackage, minNodeMajor)
+	}
+	return path, version, nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// Notification channel types
+const (
+	channelSlack   = "slack"
+	channelEmail   = "email"
+	channelDesktop = "desktop"
+)
+
+// Events that are only notified, in addition to the lifecycle events of the control socket
+const (
+	eventCrash           = "crash"
+	eventQuarantined     = "quarantined"
+	eventApprovalPending = "approval_pending"
+	eventAuthSignal      = "auth_signal"
+	eventBudgetExceeded  = "budget_exceeded"
+)
+
+// notificationEvents are the event types that can be routed to channels
+var notificationEvents = []string{
+	eventChildStarted, eventHandshakeOK, eventRestart, eventStateSaved, eventShuttingDown,
+	eventCrash, eventQuarantined, eventApprovalPending, eventAuthSignal, eventBudgetExceeded, eventLeaseExpired,
+}
+
+// NotificationsConfig sends session events to people
+type NotificationsConfig struct {
+	// Channels are the named destinations
+	Channels map[string]*ChannelConfig `json:"channels,omitempty"`
+	// Events maps an event type, or "*" for all, to the channels it is sent to
+	Events map[string][]string `json:"events,omitempty"`
+}
+
+// ChannelConfig is one notification destination
+type ChannelConfig struct {
+	// Type is slack, email or desktop
+	Type string `json:"type"`
+	// WebhookURL is the Slack incoming webhook
+	WebhookURL string `json:"webhookUrl,omitempty"`
+	// SMTP is host:port of the mail server
+	SMTP string `json:"smtp,omitempty"`
+	// Username logs in to the mail server, with the password read from PasswordEnv
+	Username    string   `json:"username,omitempty"`
+	PasswordEnv string   `json:"passwordEnv,omitempty"`
+	From        string   `json:"from,omitempty"`
+	To          []string `json:"to,omitempty"`
+}
+
+// eventSink receives session events
+type eventSink interface {
+	Publish(event string, fields map[string]interface{})
+}
+
+// eventSinks publishes every event to each of its sinks
+type eventSinks []eventSink
+
+func (s eventSinks) Publish(event string, fields map[string]interface{}) {
+	for _, sink := range s {
+		sink.Publish(event, fields)
+	}
+}
+
+// notificationChannel delivers a message somewhere a human will see it
+type notificationChannel interface {
+	send(title, message string) error
+}
+
+// Notifier routes events to notification channels
+type Notifier struct {
+	profile string
+	logger  *Logger
+	// redactor applies the log redaction to the messages before they leave the machine
+	redactor *Redactor
+	channels map[string]notificationChannel
+	routes   map[string][]string
+	wg       sync.WaitGroup
+}
+
+// NewNotifier validates the notifications config and creates a notifier, or returns nil
+// when no event is routed anywhere
+func NewNotifier(config *NotificationsConfig, profile string, logger *Logger) (*Notifier, error) {
+	if config == nil || len(config.Events) == 0 {
+		return nil, nil
+	}
+	n := &Notifier{profile: profile, logger: logger, channels: make(map[string]notificationChannel), routes: config.Events}
+	for name, channel := range config.Channels {
+		c, err := newChannel(channel)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s: %v", name, err)
+		}
+		n.channels[name] = c
+	}
+	for event, names := range config.Events {
+		if event != "*" && !isNotificationEvent(event) {
+			return nil, fmt.Errorf("unknown notification event %q, expected one of %s", event, strings.Join(notificationEvents, ", "))
+		}
+		for _, name := range names {
+			if _, ok := n.channels[name]; !ok {
+				return nil, fmt.Errorf("event %s is routed to unknown notification channel %q", event, name)
+			}
+		}
+	}
+	return n, nil
+}
+
+func isNotificationEvent(event string) bool {
+	for _, known := range notificationEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func newChannel(config *ChannelConfig) (notificationChannel, error) {
+	switch config.Type {
+	case channelSlack:
+		if config.WebhookURL == "" {
+			return nil, errors.New("slack channels need a webhookUrl")
+		}
+		return &slackChannel{url: config.WebhookURL}, nil
+	case channelEmail:
+		if config.SMTP == "" || config.From == "" || len(config.To) == 0 {
+			return nil, errors.New("email channels need smtp, from and to")
+		}
+		if _, _, err := net.SplitHostPort(config.SMTP); err != nil {
+			return nil, fmt.Errorf("invalid smtp address %q: %v", config.SMTP, err)
+		}
+		return &emailChannel{config: config}, nil
+	case channelDesktop:
+		return desktopChannel{}, nil
+	}
+	return nil, fmt.Errorf("unknown channel type %q, expected %s, %s or %s", config.Type, channelSlack, channelEmail, channelDesktop)
+}
+
+// Publish sends the event to its channels in the background. A nil notifier sends nothing.
+func (n *Notifier) Publish(event string, fields map[string]interface{}) {
+	if n == nil {
+		return
+	}
+	names := append(append([]string(nil), n.routes[event]...), n.routes["*"]...)
+	if len(names) == 0 {
+		return
+	}
+	title := fmt.Sprintf("playwrightwrap %s: %s", n.profile, event)
+	message := n.redactor.String(redactLogs, formatFields(fields))
+	sent := make(map[string]bool)
+	for _, name := range names {
+		if sent[name] {
+			continue
+		}
+		sent[name] = true
+		channel := n.channels[name]
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			if err := channel.send(title, message); err != nil {
+				n.logger.Log("Notification to %s failed: %v", name, err)
+			}
+		}()
+	}
+}
+
+// Wait blocks until the notifications sent so far are delivered. A nil notifier returns at once.
+func (n *Notifier) Wait() {
+	if n != nil {
+		n.wg.Wait()
+	}
+}
+
+// formatFields renders event fields as sorted key=value pairs
+func formatFields(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, fields[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// slackChannel posts to a Slack incoming webhook
+type slackChannel struct {
+	url string
+}
+
+func (c *slackChannel) send(title, message string) error {
+	body, err := json.Marshal(map[string]string{"text": fmt.Sprintf("*%s*\n%s", title, message)})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("slack webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// emailChannel sends mail through an SMTP server
+type emailChannel struct {
+	config *ChannelConfig
+}
+
+func (c *emailChannel) send(title, message string) error {
+	var auth smtp.Auth
+	if c.config.Username != "" {
+		host, _, _ := net.SplitHostPort(c.config.SMTP)
+		auth = smtp.PlainAuth("", c.config.Username, os.Getenv(c.config.PasswordEnv), host)
+	}
+	mail := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		c.config.From, strings.Join(c.config.To, ", "), title, clockNow().Format(time.RFC1123Z), message)
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(c.config.SMTP, auth, c.config.From, c.config.To, []byte(mail)) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(notifyTimeout):
+		return fmt.Errorf("no answer from %s within %v", c.config.SMTP, notifyTimeout)
+	}
+}
+
+// desktopChannel shows a desktop notification
+type desktopChannel struct{}
+
+func (desktopChannel) send(title, message string) error {
+	return desktopNotify(title, message)
+}
+
+// windowsToast shows a toast through the Windows runtime; the text comes from the
+// environment so it needs no quoting
+const windowsToast = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:PLAYWRIGHTWRAP_TOAST_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:PLAYWRIGHTWRAP_TOAST_MESSAGE)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('playwrightwrap').Show([Windows.UI.Notifications.ToastNotification]::new($template))`
+
+// desktopNotify shows a notification on the user's desktop, using notify-send on Linux,
+// osascript on macOS and a PowerShell toast on Windows
+func desktopNotify(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title)))
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToast)
+		cmd.Env = append(os.Environ(), "PLAYWRIGHTWRAP_TOAST_TITLE="+title, "PLAYWRIGHTWRAP_TOAST_MESSAGE="+message)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=playwrightwrap", title, message)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v %s", cmd.Path, err, out)
+	}
+	return nil
+}
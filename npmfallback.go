@@ -0,0 +1,17 @@
+package main
+
+import "regexp"
+
+// registryFailure matches npm errors caused by an unreachable or failing registry
+var registryFailure = regexp.MustCompile(`(?i)` +
+	`ENOTFOUND|EAI_AGAIN|ETIMEDOUT|ECONNRESET|ECONNREFUSED|ENETUNREACH|` +
+	`npm (ERR!|error) code E(5\d\d|407)|request to https?://\S+ failed|socket hang up|` +
+	`SELF_SIGNED_CERT_IN_CHAIN|UNABLE_TO_GET_ISSUER_CERT|network request .* failed`)
+
+// offlineFallbacks are the npx flags tried in order when the registry cannot be reached
+var offlineFallbacks = []string{"--prefer-offline", "--offline"}
+
+// isRegistryFailure reports whether the child's stderr shows a registry or network error
+func isRegistryFailure(stderr string) bool {
+	return registryFailure.MatchString(stderr)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+)
+
+// How npx answers its "Ok to proceed?" prompt when the package is not installed yet
+const (
+	npxInstallYes = "yes"
+	npxInstallNo  = "no"
+)
+
+// npxPromptPattern matches the prompt npx shows before installing a missing package
+var npxPromptPattern = regexp.MustCompile(`Need to install the following packages|Ok to proceed\?`)
+
+// npxInstallFlag returns the flag that answers npx's install prompt up front
+func npxInstallFlag(mode string) (string, error) {
+	switch mode {
+	case "", npxInstallYes:
+		return "--yes", nil
+	case npxInstallNo:
+		return "--no", nil
+	}
+	return "", fmt.Errorf("unknown npxInstall %q, expected %s or %s", mode, npxInstallYes, npxInstallNo)
+}
+
+// promptWatcher looks for npx's install prompt on the child's stderr, in case an npx
+// version ignores the flag, and answers it so the session does not stall. It stops
+// watching once the child writes to stdout: the server is running and anything that
+// looks like the prompt from then on is page content.
+type promptWatcher struct {
+	mode   string
+	logger *Logger
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	recent   []byte
+	seen     bool
+	disarmed bool
+	// answer writes a line to the child through the same writer as the client's
+	// messages; a prompt seen before it is set is answered when it is
+	answer  func(line []byte) error
+	pending bool
+}
+
+func newPromptWatcher(mode string, logger *Logger) *promptWatcher {
+	if mode == "" {
+		mode = npxInstallYes
+	}
+	return &promptWatcher{mode: mode, logger: logger}
+}
+
+// attach starts watching a new child, which has no writer to answer through yet
+func (w *promptWatcher) attach(cmd *exec.Cmd) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cmd, w.recent, w.seen, w.disarmed, w.answer, w.pending = cmd, nil, false, false, nil, false
+}
+
+// setAnswer sets how a yes reaches the current child
+func (w *promptWatcher) setAnswer(answer func(line []byte) error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.answer = answer
+	if w.pending {
+		w.pending = false
+		w.sendYes()
+	}
+}
+
+// disarm stops watching the current child
+func (w *promptWatcher) disarm() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.disarmed = true
+}
+
+// sendYes answers the prompt; the caller holds w.mu
+func (w *promptWatcher) sendYes() {
+	if err := w.answer([]byte("y")); err != nil {
+		w.logger.Log("Failed to answer npx: %v", err)
+	}
+}
+
+func (w *promptWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen || w.disarmed {
+		return len(p), nil
+	}
+	// Keep a little of the previous write, the prompt may be split across writes
+	w.recent = append(w.recent, p...)
+	if len(w.recent) > 256 {
+		w.recent = w.recent[len(w.recent)-256:]
+	}
+	if !npxPromptPattern.Match(w.recent) {
+		return len(p), nil
+	}
+	w.seen = true
+	if w.mode == npxInstallYes {
+		w.logger.Log("npx is asking to install %s, answering yes", mcpPackage)
+		fmt.Fprintf(os.Stderr, "playwrightwrap: npx asked to install %s, answering yes\n", mcpPackage)
+		if w.answer != nil {
+			w.sendYes()
+		} else {
+			w.pending = true
+		}
+	} else {
+		w.logger.Log("npx is asking to install %s, stopping it because npxInstall is %s", mcpPackage, w.mode)
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %s is not installed and npxInstall is %s; run `playwrightwrap warm` first\n", mcpPackage, w.mode)
+		if w.cmd.Process != nil {
+			w.cmd.Process.Kill()
+		}
+	}
+	return len(p), nil
+}
+
+// disarmReader disarms the prompt watcher on the first bytes the child writes to stdout
+type disarmReader struct {
+	io.ReadCloser
+	prompts *promptWatcher
+	once    sync.Once
+}
+
+func (r *disarmReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.once.Do(r.prompts.disarm)
+	}
+	return n, err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// policyReadOnly is the preset that lets an agent look but not act
+const policyReadOnly = "read-only"
+
+// readOnlyTools are the only tools the read-only preset allows: they read the page or
+// move between pages without acting on it. Tools missing here, including ones added
+// by later Playwright MCP versions, are blocked until they are listed or allowed.
+var readOnlyTools = []string{
+	"browser_snapshot",
+	"browser_take_screenshot",
+	"browser_navigate",
+	"browser_navigate_back",
+	"browser_navigate_forward",
+	"browser_tab_list",
+	"browser_tab_new",
+	"browser_tab_select",
+	"browser_console_messages",
+	"browser_network_requests",
+	"browser_wait_for",
+	"browser_resize",
+	"browser_generate_locator",
+	"browser_verify_*",
+}
+
+// PolicyConfig restricts which tools the client may call
+type PolicyConfig struct {
+	// Preset names a predefined rule set; "read-only" allows navigation, snapshots,
+	// screenshots and other tools that only read the page, and blocks every other tool
+	Preset string `json:"preset,omitempty"`
+	// DenyTools are tool name patterns to block, such as "browser_tab_*"
+	DenyTools []string `json:"denyTools,omitempty"`
+	// AllowTools are patterns exempt from the preset and DenyTools
+	AllowTools []string `json:"allowTools,omitempty"`
+	// DenyURLs are regular expressions of URLs the client may not navigate to
+	DenyURLs []string `json:"denyURLs,omitempty"`
+}
+
+// Policy decides whether a tool call may be forwarded
+type Policy struct {
+	name  string
+	deny  []toolRule
+	allow []toolRule
+	// only are the tools a preset allows, nil when the preset does not restrict tools
+	only []toolRule
+}
+
+// toolRule is a tool name pattern and the setting it came from
+type toolRule struct {
+	pattern string
+	source  string
+}
+
+// NewPolicy creates a policy, or returns nil when nothing is restricted
+func NewPolicy(config *PolicyConfig) (*Policy, error) {
+	if config == nil {
+		return nil, nil
+	}
+	policy := &Policy{name: "policy"}
+	switch config.Preset {
+	case "":
+	case policyReadOnly:
+		policy.name = policyReadOnly + " policy"
+		for _, tool := range readOnlyTools {
+			policy.only = append(policy.only, toolRule{tool, policyReadOnly + " preset"})
+		}
+	default:
+		return nil, fmt.Errorf("unknown policy preset %q, the only preset is %s", config.Preset, policyReadOnly)
+	}
+	for _, pattern := range config.DenyTools {
+		policy.deny = append(policy.deny, toolRule{pattern, "denyTools"})
+	}
+	for _, pattern := range config.AllowTools {
+		policy.allow = append(policy.allow, toolRule{pattern, "allowTools"})
+	}
+	for _, rule := range append(append([]toolRule(nil), policy.deny...), policy.allow...) {
+		if _, err := path.Match(rule.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern %q: %v", rule.pattern, err)
+		}
+	}
+	if len(policy.deny) == 0 && policy.only == nil {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// Check returns why the call is blocked, or "" if it is allowed. A nil policy allows everything.
+func (p *Policy) Check(call *toolCall) string {
+	if _, blocked := p.match(call.Name); !blocked {
+		return ""
+	}
+	return fmt.Sprintf("%s is blocked by the %s of this session", call.Name, p.name)
+}
+
+// match returns the rule deciding about a tool and whether it blocks the tool. A tool
+// that a preset does not list is blocked with a rule without a pattern.
+func (p *Policy) match(name string) (*toolRule, bool) {
+	if p == nil {
+		return nil, false
+	}
+	if rule := matchRule(name, p.allow); rule != nil {
+		return rule, false
+	}
+	if rule := matchRule(name, p.deny); rule != nil {
+		return rule, true
+	}
+	if p.only != nil {
+		if rule := matchRule(name, p.only); rule != nil {
+			return rule, false
+		}
+		return &toolRule{source: p.only[0].source}, true
+	}
+	return nil, false
+}
+
+func matchRule(name string, rules []toolRule) *toolRule {
+	for i := range rules {
+		if ok, _ := path.Match(rules[i].pattern, name); ok {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// matchesTool reports whether a tool name matches one of the patterns
+func matchesTool(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
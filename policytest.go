@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// argFlags collects repeated --arg name=value flags; values that parse as JSON are
+// used as such, anything else is a string
+type argFlags map[string]interface{}
+
+func (a argFlags) String() string {
+	return ""
+}
+
+func (a argFlags) Set(value string) error {
+	name, raw, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		parsed = raw
+	}
+	a[name] = parsed
+	return nil
+}
+
+// runPolicy implements "playwrightwrap policy <subcommand>"
+func runPolicy(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap policy test --tool <name> [--arg name=value ...]")
+		return 2
+	}
+	switch args[0] {
+	case "test":
+		return runPolicyTest(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown policy subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runPolicyTest evaluates a hypothetical tool call against a profile's configured
+// policies and reports which rules apply. It exits with 1 if the call would be blocked.
+func runPolicyTest(args []string) int {
+	flags := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile whose policies are evaluated")
+	tool := flags.String("tool", "", "tool name the client would call (required)")
+	arguments := argFlags{}
+	flags.Var(arguments, "arg", "tool argument as name=value, repeatable")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *tool == "" {
+		fmt.Fprintln(os.Stderr, "--tool is required")
+		return 2
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	profileConfig := config.Profile(*profile)
+	call := &toolCall{Name: *tool, Arguments: arguments}
+	lines, verdict, err := explainCall(config, profileConfig, call)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	encoded, _ := json.Marshal(call.Arguments)
+	fmt.Printf("Profile %s, %s %s\n", *profile, call.Name, encoded)
+	for _, line := range lines {
+		fmt.Println("  " + line)
+	}
+	fmt.Println("Verdict: " + verdict)
+	if verdict == verdictBlocked {
+		return 1
+	}
+	return 0
+}
+
+// Verdicts of policy test
+const (
+	verdictAllowed  = "allowed"
+	verdictBlocked  = "blocked"
+	verdictApproval = "needs approval"
+)
+
+// explainCall describes how each configured policy treats the call, in the order the
+// proxy applies them, and returns the verdict
+func explainCall(config *Config, profile *ProfileConfig, call *toolCall) ([]string, string, error) {
+	verdict := verdictAllowed
+	var lines []string
+	if profile.ToolPrefix != "" || len(profile.ToolRenames) > 0 {
+		names, err := NewToolNamer(profile.ToolPrefix, profile.ToolRenames)
+		if err != nil {
+			return nil, "", err
+		}
+		if original := names.original(call.Name); original != call.Name {
+			lines = append(lines, fmt.Sprintf("names: %s is the child's %s", call.Name, original))
+			call.Name = original
+		}
+	}
+
+	tools, err := NewToolOverrides(config, profile.Tools)
+	if err != nil {
+		return nil, "", err
+	}
+	settings := tools.settings(call.Name)
+	if settings.allow != nil && !*settings.allow {
+		lines = append(lines, fmt.Sprintf("tools: %s is blocked by its tools entry", call.Name))
+		return lines, verdictBlocked, nil
+	}
+	if settings.rate != nil {
+		lines = append(lines, fmt.Sprintf("tools: rate limited to %s", settings.rate))
+	}
+
+	policy, err := NewPolicy(profile.Policy)
+	if err != nil {
+		return nil, "", err
+	}
+	rule, blocked := policy.match(call.Name)
+	switch {
+	case blocked && rule.pattern == "":
+		lines = append(lines, fmt.Sprintf("policy: blocked, the %s does not list %s", rule.source, call.Name))
+		return lines, verdictBlocked, nil
+	case blocked:
+		lines = append(lines, fmt.Sprintf("policy: blocked by %s pattern %q", rule.source, rule.pattern))
+		return lines, verdictBlocked, nil
+	case rule != nil:
+		lines = append(lines, fmt.Sprintf("policy: allowed by %s pattern %q", rule.source, rule.pattern))
+	case policy == nil:
+		lines = append(lines, "policy: no tool policy configured")
+	default:
+		lines = append(lines, "policy: allowed, no rule matches")
+	}
+
+	if call.Name == "browser_navigate" {
+		urls, err := NewURLPolicy(profile.Network, profile.Policy)
+		if err != nil {
+			return nil, "", err
+		}
+		if reason := urls.Check(call.stringArg("url")); reason != "" {
+			lines = append(lines, "urls: "+reason)
+			return lines, verdictBlocked, nil
+		}
+		if urls != nil {
+			lines = append(lines, "urls: allowed by the network origins and denyURLs")
+		}
+	}
+
+	if budget := profile.Budget; budget != nil && (budget.ToolCalls > 0 || budget.Navigations > 0) {
+		var limits []string
+		if budget.ToolCalls > 0 {
+			limits = append(limits, fmt.Sprintf("%d tool calls", budget.ToolCalls))
+		}
+		if budget.Navigations > 0 && call.Name == "browser_navigate" {
+			limits = append(limits, fmt.Sprintf("%d navigations", budget.Navigations))
+		}
+		if len(limits) > 0 {
+			lines = append(lines, "budget: counts against "+strings.Join(limits, " and "))
+		}
+	}
+
+	approvals, err := NewApprovals(profile.Approval, &Logger{})
+	if err != nil {
+		return nil, "", err
+	}
+	if approvals != nil {
+		if rule := approvals.rule(call); rule != "" {
+			lines = append(lines, fmt.Sprintf("approval: held for up to %v by %s", approvals.timeout, rule))
+			verdict = verdictApproval
+		} else {
+			lines = append(lines, "approval: not required")
+		}
+	}
+
+	if cache := NewResponseCache(profile.Cache); cache != nil {
+		if cache.key(call) != "" {
+			lines = append(lines, fmt.Sprintf("cache: identical calls are answered from cache for %v", cache.ttl))
+		} else {
+			lines = append(lines, "cache: not cached, clears the cache")
+		}
+	}
+
+	if throttle := NewThrottle(profile.Throttle); throttle != nil && call.Name == "browser_navigate" {
+		parsed, err := url.Parse(call.stringArg("url"))
+		if err == nil && parsed.Hostname() != "" {
+			host := strings.ToLower(parsed.Hostname())
+			interval, entry := throttle.interval(host)
+			switch {
+			case interval <= 0:
+				lines = append(lines, fmt.Sprintf("throttle: navigations to %s are not paced", host))
+			case entry != "":
+				lines = append(lines, fmt.Sprintf("throttle: navigations to %s are paced %v apart by hosts entry %q", host, interval, entry))
+			default:
+				lines = append(lines, fmt.Sprintf("throttle: navigations to %s are paced %v apart by the default interval", host, interval))
+			}
+		}
+	}
+	return lines, verdict, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const defaultProbeTimeout = time.Minute
+
+// ProbeConfig checks before a session starts that the profile is still signed in
+type ProbeConfig struct {
+	// URL is a page that shows the markers only to an authenticated user
+	URL string `json:"url"`
+	// Markers are patterns of which one must appear in the page, one per language the
+	// site may answer in
+	Markers []string `json:"markers"`
+	// Timeout bounds the whole probe, one minute by default
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// errNotAuthenticated is returned when the probe page shows none of the markers
+var errNotAuthenticated = errors.New("profile no longer authenticated")
+
+// probe is a compiled ProbeConfig
+type probe struct {
+	url     string
+	markers []*regexp.Regexp
+	timeout time.Duration
+}
+
+// newProbe compiles the markers, or returns nil when no probe is configured
+func newProbe(config *ProbeConfig) (*probe, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.URL == "" {
+		return nil, errors.New("probe has no url")
+	}
+	if len(config.Markers) == 0 {
+		return nil, errors.New("probe has no markers")
+	}
+	p := &probe{url: config.URL, timeout: time.Duration(config.Timeout)}
+	if p.timeout <= 0 {
+		p.timeout = defaultProbeTimeout
+	}
+	for _, pattern := range config.Markers {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe marker %q: %v", pattern, err)
+		}
+		p.markers = append(p.markers, re)
+	}
+	return p, nil
+}
+
+// match reports whether text shows one of the markers
+func (p *probe) match(text string) bool {
+	for _, re := range p.markers {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run starts a separate child with the session's arguments and state, opens the probe
+// page and looks for the markers, first in the navigation result and then in a fresh
+// snapshot for pages that render late. The child is stopped either way.
+func (p *probe) Run(npxArgs, env []string, settings *childSettings, npxInstall string, logger *Logger) error {
+	prompts := newPromptWatcher(npxInstall, logger)
+	child, err := startChild(npxArgs, env, settings, &stderrTail{}, prompts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		child.stdin.Close()
+		child.cmd.Process.Kill()
+		child.cmd.Wait()
+	}()
+
+	responses := make(chan *rpcMessage)
+	go func() {
+		defer close(responses)
+		lr := newLineReader(child.stdout)
+		for {
+			line, err := lr.Next()
+			if err != nil {
+				return
+			}
+			msg := &rpcMessage{}
+			if json.Unmarshal(line, msg) == nil && msg.ID != nil && msg.Method == "" {
+				responses <- msg
+			}
+		}
+	}()
+	deadline := time.After(p.timeout)
+	writer := &lineWriter{w: child.stdin}
+	prompts.setAnswer(writer.Write)
+	request := func(id int, method string, params interface{}) (*rpcMessage, error) {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		line, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(fmt.Sprint(id)), Method: method, Params: encoded})
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.Write(line); err != nil {
+			return nil, err
+		}
+		for {
+			select {
+			case msg, ok := <-responses:
+				if !ok {
+					return nil, fmt.Errorf("the child exited before answering %s", method)
+				}
+				if string(msg.ID) != fmt.Sprint(id) {
+					continue
+				}
+				if msg.Error != nil {
+					return nil, fmt.Errorf("%s failed: %s", method, msg.Error.Message)
+				}
+				return msg, nil
+			case <-deadline:
+				return nil, fmt.Errorf("no answer to %s within %v", method, p.timeout)
+			}
+		}
+	}
+
+	initialize := map[string]interface{}{
+		"protocolVersion": callProtocol,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "playwrightwrap-probe", "version": "1"},
+	}
+	if _, err := request(1, "initialize", initialize); err != nil {
+		return err
+	}
+	if err := writer.Write([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		return err
+	}
+	response, err := request(2, "tools/call", toolCall{Name: "browser_navigate", Arguments: map[string]interface{}{"url": p.url}})
+	if err != nil {
+		return err
+	}
+	result := parseToolResult(response.Result)
+	if result.IsError {
+		return fmt.Errorf("opening %s failed: %s", p.url, result.text())
+	}
+	if p.match(result.text()) {
+		return nil
+	}
+	response, err = request(3, "tools/call", toolCall{Name: "browser_snapshot"})
+	if err != nil {
+		return err
+	}
+	if p.match(parseToolResult(response.Result).text()) {
+		return nil
+	}
+	return errNotAuthenticated
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runProfiles implements "playwrightwrap profiles <subcommand>"
+func runProfiles(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap profiles export|import|release [flags]")
+		return 2
+	}
+	switch args[0] {
+	case "export":
+		return runProfilesExport(args[1:])
+	case "import":
+		return runProfilesImport(args[1:])
+	case "release":
+		return runProfilesRelease(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown profiles subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runProfilesExport writes a profile's storage state, metadata and config to a bundle
+func runProfilesExport(args []string) int {
+	flags := flag.NewFlagSet("profiles export", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile to export")
+	output := flags.String("output", "", "bundle file to write (required)")
+	encrypt := flags.Bool("encrypt", false, "encrypt the bundle with a passphrase, or for --recipient")
+	recipient := flags.String("recipient", "", "age recipient to encrypt for instead of a passphrase (implies --encrypt)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "--output is required")
+		return 2
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	source := config.storageStatePath(*profile)
+	state, err := os.ReadFile(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read storage state %s: %v\n", source, err)
+		return 1
+	}
+
+	metadata := bundleMetadata{Profile: *profile, ExportedAt: clockNow().UTC()}
+	if hostname, err := os.Hostname(); err == nil {
+		metadata.ExportedBy = hostname
+	}
+	// The storage state location is local to this machine and not shared
+	profileConfig := *config.Profile(*profile)
+	profileConfig.StorageState = ""
+	data, err := packBundle(&profileBundle{Metadata: metadata, State: state, Config: &profileConfig})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create bundle: %v\n", err)
+		return 1
+	}
+
+	switch {
+	case *recipient != "":
+		data, err = runAge(data, "--encrypt", "--recipient", *recipient)
+	case *encrypt:
+		var passphrase string
+		if passphrase, err = readPassphrase("Passphrase for the bundle: "); err == nil {
+			data, err = encryptWithPassphrase(data, passphrase)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Warning: the bundle is not encrypted and contains live credentials")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encrypt bundle: %v\n", err)
+		return 1
+	}
+
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write bundle %s: %v\n", *output, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported profile %s to %s\n", *profile, *output)
+	return 0
+}
+
+// runProfilesImport restores a bundle into a profile, merging its storage state
+func runProfilesImport(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap profiles import <bundle> [--profile name] [--identity file] [--replace] [--accept-config]")
+		return 2
+	}
+	bundlePath := args[0]
+	flags := flag.NewFlagSet("profiles import", flag.ContinueOnError)
+	profile := flags.String("profile", "", "profile to import into, the bundle's profile when empty")
+	identity := flags.String("identity", "", "age identity file for bundles encrypted to a recipient")
+	replace := flags.Bool("replace", false, "replace the storage state and profile config instead of merging")
+	acceptConfig := flags.Bool("accept-config", false, "also take the bundle's settings that run code, place files or change what the session may do")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read bundle %s: %v\n", bundlePath, err)
+		return 1
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(bundleMagic)):
+		var passphrase string
+		if passphrase, err = readPassphrase("Passphrase for the bundle: "); err == nil {
+			data, err = decryptWithPassphrase(data, passphrase)
+		}
+	case bytes.HasPrefix(data, []byte(ageMagic)):
+		if *identity == "" {
+			err = fmt.Errorf("the bundle is encrypted for an age recipient, pass --identity")
+		} else {
+			data, err = runAge(data, "--decrypt", "--identity", *identity)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decrypt bundle: %v\n", err)
+		return 1
+	}
+	bundle, err := unpackBundle(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read bundle: %v\n", err)
+		return 1
+	}
+	name := *profile
+	if name == "" {
+		name = bundle.Metadata.Profile
+	}
+	if name == "" {
+		name = defaultProfileName
+	}
+	if err := checkProfileName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import bundle: %v\n", err)
+		return 1
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	incoming := &StorageState{}
+	if err := json.Unmarshal(bundle.State, incoming); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid storage state in bundle: %v\n", err)
+		return 1
+	}
+	target := config.storageStatePath(name)
+	state := incoming
+	if !*replace {
+		if existing, err := loadStorageState(target); err == nil {
+			state = mergeStorageState(existing, incoming)
+		}
+	}
+	if err := state.save(target); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write storage state %s: %v\n", target, err)
+		return 1
+	}
+
+	// The state was written to the local path, the bundle's path means nothing here
+	bundle.Config.StorageState = ""
+	if held := bundle.Config.privilegedSettings(); len(held) > 0 {
+		names := make([]string, 0, len(held))
+		for field := range held {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+		for _, field := range names {
+			data, _ := json.Marshal(held[field])
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", field, data)
+		}
+		if *acceptConfig {
+			fmt.Fprintf(os.Stderr, "Taking the bundle's %s above\n", strings.Join(names, ", "))
+		} else {
+			fmt.Fprintf(os.Stderr, "Not taking the bundle's %s above, which run code, place files or change what the session may do; review them and pass --accept-config to take them\n", strings.Join(names, ", "))
+			bundle.Config.dropPrivilegedSettings()
+		}
+	}
+
+	// Adopt the bundled profile config unless the profile is already configured differently
+	existing, configured := config.Profiles[name]
+	switch {
+	case reflect.DeepEqual(bundle.Config, &ProfileConfig{}):
+	case !configured || *replace:
+		if configured && existing != nil {
+			bundle.Config.StorageState = existing.StorageState
+			if !*acceptConfig {
+				bundle.Config.keepPrivilegedSettings(existing)
+			}
+		}
+		if config.Profiles == nil {
+			config.Profiles = make(map[string]*ProfileConfig)
+		}
+		config.Profiles[name] = bundle.Config
+		if err := config.save(configPath()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update config %s: %v\n", configPath(), err)
+			return 1
+		}
+	case !reflect.DeepEqual(existing, bundle.Config):
+		fmt.Fprintf(os.Stderr, "Profile %s is already configured, keeping its settings (use --replace to take the bundle's)\n", name)
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported bundle of profile %s exported %s into profile %s\n",
+		bundle.Metadata.Profile, bundle.Metadata.ExportedAt.Format(time.RFC3339), name)
+	return 0
+}
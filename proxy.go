@@ -0,0 +1,707 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// internalIDPrefix marks the ids of requests the wrapper sends to the child itself
+const internalIDPrefix = "playwrightwrap-"
+
+// rpcMessage is a JSON-RPC 2.0 message as exchanged over the MCP stdio transport
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error object of a JSON-RPC response
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// isRequest reports whether the message is a request that expects a response
+func (m *rpcMessage) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// isResponse reports whether the message is a response to an earlier request
+func (m *rpcMessage) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// lineReader reads newline-delimited messages without the size limit of bufio.Scanner,
+// since snapshots and screenshots can easily exceed it
+type lineReader struct {
+	r *bufio.Reader
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the next non-empty line without its trailing newline
+func (lr *lineReader) Next() ([]byte, error) {
+	for {
+		line, err := lr.r.ReadBytes('\n')
+		line = trimLine(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func trimLine(line []byte) []byte {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// lineWriter writes newline-delimited messages, safe for concurrent use
+type lineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lineWriter) Write(line []byte) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	buf := make([]byte, 0, len(line)+1)
+	buf = append(buf, line...)
+	buf = append(buf, '\n')
+	_, err := lw.w.Write(buf)
+	return err
+}
+
+// toolCall holds the parameters of a tools/call request
+type toolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// stringArg returns a string argument of the call, empty if absent
+func (c *toolCall) stringArg(name string) string {
+	value, _ := c.Arguments[name].(string)
+	return value
+}
+
+// Proxy relays MCP messages between the client on stdio and the playwright child process
+type Proxy struct {
+	logger   *Logger
+	recorder *Recorder
+	client   *lineWriter
+	child    *lineWriter
+
+	// policies holds the tool policy and navigation throttle, swapped on config reload
+	policies atomic.Pointer[proxyPolicies]
+	// redactor hides sensitive values in responses, nil when disabled
+	redactor *Redactor
+	// auth flags credential refreshes, nil when disabled
+	auth *AuthDetector
+	// budget caps the session's tool calls, nil when unlimited
+	budget *Budget
+	// approvals holds sensitive calls for a human decision, nil when disabled
+	approvals *Approvals
+	// cache answers repeated read-only calls, nil when disabled
+	cache *ResponseCache
+	// names renames the child's tools for the client, nil when they keep their names
+	names *ToolNamer
+	// validator checks tool call arguments against the child's schemas, nil when disabled
+	validator *ArgumentValidator
+	// timer receives the handshake and first tool call durations, nil when disabled
+	timer *StartupTimer
+	// stats counts tool calls, errors and navigations for the session metrics
+	stats proxyStats
+	// events receives budget and auth signal events, nil when nobody listens
+	events eventSink
+	// lease refuses tool calls once the session's credentials are revoked, nil when unleased
+	lease *Lease
+	// history exports the pages the session visited, nil when not configured
+	history *NavigationHistory
+	// capture screenshots the page after failed calls, nil when not configured
+	capture *ErrorCapture
+	// downloads is told about the files the child saves, nil when downloads are not managed
+	downloads *DownloadTracker
+
+	pendingMu sync.Mutex
+	pending   map[string]*pendingRequest
+
+	// replay holds client messages sent before the child produced any output, so they
+	// can be resent if the child has to be started again
+	replayMu sync.Mutex
+	replay   [][]byte
+	spoke    atomic.Bool
+	closed   bool
+
+	internalMu  sync.Mutex
+	internalSeq int
+	waiters     map[string]chan *rpcMessage
+	ready       chan struct{}
+	readyOnce   sync.Once
+	// serverVersion is the version the child reported in its initialize result
+	serverVersion atomic.Pointer[string]
+}
+
+// pendingRequest is a client request waiting for the child's response
+type pendingRequest struct {
+	method string
+	// call is set for tools/call requests
+	call *toolCall
+	sent time.Time
+	// cacheKey is set for cacheable calls, whose results are stored if the cache was
+	// not invalidated since cacheGeneration
+	cacheKey        string
+	cacheGeneration int
+	// settings are the tools config overrides of the call
+	settings *toolSettings
+	// timeout answers the call when the child is too slow, after which its response
+	// is dropped
+	timeout  *time.Timer
+	timedOut bool
+}
+
+// NewProxy creates a proxy writing client-bound messages to clientOut. The child is
+// connected with AttachChild.
+func NewProxy(logger *Logger, recorder *Recorder, clientOut io.Writer) *Proxy {
+	return &Proxy{
+		logger:   logger,
+		recorder: recorder,
+		client:   &lineWriter{w: clientOut},
+		child:    &lineWriter{w: io.Discard},
+		pending:  make(map[string]*pendingRequest),
+		waiters:  make(map[string]chan *rpcMessage),
+		ready:    make(chan struct{}),
+	}
+}
+
+// ServeClient forwards messages read from the client to the child until the client closes its end
+func (p *Proxy) ServeClient(r io.Reader) error {
+	lr := newLineReader(r)
+	for {
+		line, err := lr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		p.stats.bytesFromClient.Add(int64(len(line)) + 1)
+		p.recorder.Record(directionClient, line)
+		line, ok := p.inspectClient(line)
+		if !ok {
+			continue
+		}
+		p.forwardClient(line)
+	}
+}
+
+// forwardClient forwards a client message to the child. A failed write means the child
+// is gone; the wrapper either restarts it or exits.
+func (p *Proxy) forwardClient(line []byte) {
+	if err := p.forward(line); err != nil {
+		p.logger.Log("Failed to forward message to child: %v", err)
+	}
+}
+
+// forward writes a client message to the child, keeping it for replay until the child speaks
+func (p *Proxy) forward(line []byte) error {
+	if p.spoke.Load() {
+		return p.child.Write(line)
+	}
+	p.replayMu.Lock()
+	defer p.replayMu.Unlock()
+	if !p.spoke.Load() {
+		p.replay = append(p.replay, line)
+	}
+	return p.child.Write(line)
+}
+
+// AttachChild connects the proxy to a newly started child. Client messages the previous
+// child never answered are resent to it.
+func (p *Proxy) AttachChild(childIn io.WriteCloser) {
+	p.replayMu.Lock()
+	defer p.replayMu.Unlock()
+	p.child.mu.Lock()
+	p.child.w = childIn
+	p.child.mu.Unlock()
+	for _, line := range p.replay {
+		if err := p.child.Write(line); err != nil {
+			p.logger.Log("Failed to replay message to child: %v", err)
+		}
+	}
+	if p.closed {
+		childIn.Close()
+	}
+}
+
+// CloseChild closes the child's stdin after the client closed its end
+func (p *Proxy) CloseChild() {
+	p.replayMu.Lock()
+	p.closed = true
+	p.replayMu.Unlock()
+	p.child.mu.Lock()
+	defer p.child.mu.Unlock()
+	if closer, ok := p.child.w.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// Spoke reports whether the current child has produced any output
+func (p *Proxy) Spoke() bool {
+	return p.spoke.Load()
+}
+
+// ServeChild forwards messages read from the child to the client until the child closes its end
+func (p *Proxy) ServeChild(r io.Reader) error {
+	lr := newLineReader(r)
+	for {
+		line, err := lr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !p.spoke.Load() {
+			p.replayMu.Lock()
+			p.spoke.Store(true)
+			p.replay = nil
+			p.replayMu.Unlock()
+		}
+		line, ok := p.inspectChild(line)
+		if !ok {
+			continue
+		}
+		if err := p.sendClient(p.redactor.JSON(redactResponses, line)); err != nil {
+			return err
+		}
+	}
+}
+
+// sendClient records a message and writes it to the client
+func (p *Proxy) sendClient(line []byte) error {
+	p.recorder.Record(directionServer, line)
+	if err := p.client.Write(line); err != nil {
+		p.logger.Log("Failed to forward message to client: %v", err)
+		return err
+	}
+	p.stats.bytesToClient.Add(int64(len(line)) + 1)
+	return nil
+}
+
+// inspectClient applies the wrapper's policies to a client message and returns the
+// message to forward, or false if it should not be. Rejected calls are answered here.
+// Calls held for approval or by the throttle are forwarded later from their own
+// goroutine, so that the client's other messages are not held up behind them.
+func (p *Proxy) inspectClient(line []byte) ([]byte, bool) {
+	var msg rpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil || !msg.isRequest() {
+		return line, true
+	}
+	request := &pendingRequest{method: msg.Method, sent: clockNow()}
+	if msg.Method == "tools/call" {
+		request.call = &toolCall{}
+		if err := json.Unmarshal(msg.Params, request.call); err != nil {
+			return line, true
+		}
+	}
+	call := request.call
+	if call != nil && p.names != nil {
+		rewritten, err := p.names.rewriteCall(&msg, call)
+		if err != nil {
+			p.logger.Log("Failed to rename tool %s: %v", call.Name, err)
+		} else if rewritten != nil {
+			line = rewritten
+		}
+	}
+	policies := p.policies.Load()
+	if policies == nil {
+		policies = &proxyPolicies{}
+	}
+	if call != nil {
+		p.stats.toolCalls.Add(1)
+		p.stats.addTraffic(call.Name, len(line), 0)
+		if reason := p.screenCall(call, policies); reason != "" {
+			p.rejectCall(&msg, call, reason)
+			return nil, false
+		}
+		if p.approvals.required(call) {
+			go func() {
+				if reason := p.approvals.Wait(call); reason != "" {
+					p.rejectCall(&msg, call, reason)
+					return
+				}
+				if line, delay, ok := p.admit(&msg, line, request, policies); ok {
+					time.Sleep(delay)
+					p.forwardClient(line)
+				}
+			}()
+			return nil, false
+		}
+	}
+	line, delay, ok := p.admit(&msg, line, request, policies)
+	if ok && delay > 0 {
+		time.AfterFunc(delay, func() { p.forwardClient(line) })
+		return nil, false
+	}
+	return line, ok
+}
+
+// admit answers a screened request from the cache or records it as pending, and returns
+// the message to forward and how long the throttle holds it
+func (p *Proxy) admit(msg *rpcMessage, line []byte, request *pendingRequest, policies *proxyPolicies) ([]byte, time.Duration, bool) {
+	call := request.call
+	if call != nil {
+		request.settings = policies.tools.settings(call.Name)
+		if key := p.cache.key(call); key != "" {
+			if result := p.cache.Get(key); result != nil {
+				p.stats.cacheHits.Add(1)
+				p.logger.Log("Answered %s from cache", call.Name)
+				p.reply(msg, request.settings.redactor.JSON(redactResponses, result))
+				return nil, 0, false
+			}
+			request.cacheKey, request.cacheGeneration = key, p.cache.Generation()
+		} else {
+			p.cache.Invalidate()
+		}
+	}
+
+	p.pendingMu.Lock()
+	p.pending[string(msg.ID)] = request
+	if call != nil && request.settings.timeout > 0 {
+		request.timeout = time.AfterFunc(request.settings.timeout, func() { p.timeoutCall(msg, request) })
+	}
+	p.pendingMu.Unlock()
+	if call == nil {
+		return line, 0, true
+	}
+	return line, p.paceNavigation(call, policies), true
+}
+
+// timeoutCall answers a call the child did not answer within the tool's timeout and
+// cancels it in the child
+func (p *Proxy) timeoutCall(msg *rpcMessage, request *pendingRequest) {
+	p.pendingMu.Lock()
+	if p.pending[string(msg.ID)] != request {
+		p.pendingMu.Unlock()
+		return
+	}
+	request.timedOut = true
+	p.pendingMu.Unlock()
+
+	reason := fmt.Sprintf("%s timed out after %v", request.call.Name, request.settings.timeout)
+	p.stats.toolErrors.Add(1)
+	p.logger.Log("Call %s: %s", msg.ID, reason)
+	p.reply(msg, errorResult(reason))
+	params, err := json.Marshal(map[string]interface{}{"requestId": msg.ID, "reason": reason})
+	if err != nil {
+		return
+	}
+	cancel, err := json.Marshal(rpcMessage{JSONRPC: "2.0", Method: "notifications/cancelled", Params: params})
+	if err != nil {
+		return
+	}
+	if err := p.child.Write(cancel); err != nil {
+		p.logger.Log("Failed to cancel call in the child: %v", err)
+	}
+}
+
+// screenCall runs a tool call past the lease, the validator, the tools config, the policies and the budget and
+// returns why it is rejected, or "" if it may proceed. The approval gate comes after it.
+func (p *Proxy) screenCall(call *toolCall, policies *proxyPolicies) string {
+	if reason := p.lease.Check(); reason != "" {
+		return reason
+	}
+	if reason := p.validator.Validate(call); reason != "" {
+		return reason
+	}
+	settings := policies.tools.settings(call.Name)
+	if reason := settings.Check(call); reason != "" {
+		return reason
+	}
+	if reason := policies.policy.Check(call); reason != "" {
+		return reason
+	}
+	if call.Name == "browser_navigate" {
+		if reason := policies.urls.Check(call.stringArg("url")); reason != "" {
+			return reason
+		}
+	}
+	if reason := p.budget.Allow(call); reason != "" {
+		if _, rejected := p.budget.Exceeded(); rejected == 1 {
+			p.publish(eventBudgetExceeded, map[string]interface{}{"reason": reason, "tool": call.Name})
+		}
+		return reason
+	}
+	settings.Count()
+	return ""
+}
+
+// paceNavigation counts a navigation and returns how long the throttle holds it
+func (p *Proxy) paceNavigation(call *toolCall, policies *proxyPolicies) time.Duration {
+	if call.Name != "browser_navigate" {
+		return 0
+	}
+	p.stats.navigations.Add(1)
+	target := call.stringArg("url")
+	delay := policies.throttle.Reserve(target)
+	if delay > 0 {
+		p.logger.Log("Throttling navigation to %s by %v", target, delay)
+	}
+	return delay
+}
+
+// rejectCall answers a tool call the wrapper will not forward with an error result, so
+// the agent sees why it failed
+func (p *Proxy) rejectCall(msg *rpcMessage, call *toolCall, reason string) {
+	p.stats.toolRejections.Add(1)
+	p.logger.Log("Rejected %s call: %s", call.Name, reason)
+	p.reply(msg, errorResult(reason))
+}
+
+// errorResult is a tool result reporting an error of the wrapper's
+func errorResult(reason string) json.RawMessage {
+	result, _ := json.Marshal(map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": "playwrightwrap: " + reason}},
+		"isError": true,
+	})
+	return result
+}
+
+// reply answers a client request in place of the child
+func (p *Proxy) reply(msg *rpcMessage, result json.RawMessage) {
+	response, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: result})
+	if err != nil {
+		return
+	}
+	p.sendClient(p.redactor.JSON(redactResponses, response))
+}
+
+// notifyClient sends the client a log message notification of the wrapper's own
+func (p *Proxy) notifyClient(level, message string) {
+	params, err := json.Marshal(map[string]string{"level": level, "logger": "playwrightwrap", "data": message})
+	if err != nil {
+		return
+	}
+	notification, err := json.Marshal(rpcMessage{JSONRPC: "2.0", Method: "notifications/message", Params: params})
+	if err != nil {
+		return
+	}
+	p.sendClient(notification)
+}
+
+// inspectChild observes a child message and returns the message to forward to the
+// client, or false if it should not be. Responses to the wrapper's own requests are
+// consumed here.
+func (p *Proxy) inspectChild(line []byte) ([]byte, bool) {
+	var msg rpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil || !msg.isResponse() {
+		return line, true
+	}
+	// Files the child saved, also for internal calls such as error captures, are not downloads
+	if msg.Result != nil {
+		p.downloads.Claim(parseToolResult(msg.Result).text())
+	}
+	if p.deliverInternal(&msg) {
+		return nil, false
+	}
+
+	p.pendingMu.Lock()
+	request, ok := p.pending[string(msg.ID)]
+	delete(p.pending, string(msg.ID))
+	if ok && request.timeout != nil {
+		request.timeout.Stop()
+	}
+	p.pendingMu.Unlock()
+	if !ok {
+		return line, true
+	}
+	if request.call != nil {
+		p.stats.addTraffic(request.call.Name, 0, len(line))
+	}
+	if request.timedOut {
+		p.logger.Log("Dropped the late response to timed out call %s", msg.ID)
+		return nil, false
+	}
+	if msg.Error != nil {
+		if request.call != nil {
+			p.stats.toolErrors.Add(1)
+			p.capture.Capture(request.call, msg.Error.Message)
+		}
+		return line, true
+	}
+	if request.method == "tools/list" {
+		p.validator.Learn(msg.Result)
+	}
+	if request.method == "tools/list" && p.names != nil {
+		rewritten, err := p.names.rewriteList(&msg)
+		if err != nil {
+			p.logger.Log("Failed to rename tools in tools/list: %v", err)
+			return line, true
+		}
+		return rewritten, true
+	}
+	if request.method == "initialize" {
+		p.timer.Record(phaseHandshake, clockSince(request.sent))
+		var initialize struct {
+			ServerInfo struct {
+				Version string `json:"version"`
+			} `json:"serverInfo"`
+		}
+		if json.Unmarshal(msg.Result, &initialize) == nil && initialize.ServerInfo.Version != "" {
+			p.serverVersion.Store(&initialize.ServerInfo.Version)
+		}
+		p.readyOnce.Do(func() { close(p.ready) })
+		return line, true
+	}
+	if request.call == nil {
+		return line, true
+	}
+	p.timer.Record(phaseFirstToolCall, clockSince(request.sent))
+	if max := request.settings.maxResponseSize; max > 0 && len(line) > max {
+		reason := fmt.Sprintf("the %s result of %d bytes exceeds the limit of %d bytes", request.call.Name, len(line), max)
+		p.stats.toolErrors.Add(1)
+		p.logger.Log("Call %s: %s", msg.ID, reason)
+		p.reply(&msg, errorResult(reason))
+		return nil, false
+	}
+	line = request.settings.redactor.JSON(redactResponses, line)
+	result := parseToolResult(msg.Result)
+	if result.IsError {
+		p.stats.toolErrors.Add(1)
+		p.capture.Capture(request.call, result.text())
+		return line, true
+	}
+	if url := pageURL(result.text()); url != "" {
+		p.stats.pageURL.Store(&url)
+		p.history.Observe(request.call, url)
+	}
+	if request.cacheKey != "" {
+		p.cache.Put(request.cacheKey, request.cacheGeneration, msg.Result)
+	}
+	if signal := p.auth.Observe(request.call, result.text()); signal != "" {
+		p.logger.Log("Session state marked dirty: %s", signal)
+		p.publish(eventAuthSignal, map[string]interface{}{"signal": signal, "tool": request.call.Name})
+	}
+	return line, true
+}
+
+// publish sends an event to the proxy's sink if it has one
+func (p *Proxy) publish(event string, fields map[string]interface{}) {
+	if p.events != nil {
+		p.events.Publish(event, fields)
+	}
+}
+
+// ServerVersion returns the version the child reported on initialize, "" before that
+func (p *Proxy) ServerVersion() string {
+	if version := p.serverVersion.Load(); version != nil {
+		return *version
+	}
+	return ""
+}
+
+// Ready is closed once the child has answered the client's initialize request
+func (p *Proxy) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// CallTool sends a tools/call request of the wrapper's own to the child and waits for its
+// result. It must only be used after Ready, once the client has initialized the session.
+func (p *Proxy) CallTool(name string, arguments map[string]interface{}, timeout time.Duration) (*toolResult, error) {
+	params, err := json.Marshal(toolCall{Name: name, Arguments: arguments})
+	if err != nil {
+		return nil, err
+	}
+
+	p.internalMu.Lock()
+	p.internalSeq++
+	id := fmt.Sprintf("%q", fmt.Sprintf("%s%d", internalIDPrefix, p.internalSeq))
+	waiter := make(chan *rpcMessage, 1)
+	p.waiters[id] = waiter
+	p.internalMu.Unlock()
+	defer func() {
+		p.internalMu.Lock()
+		delete(p.waiters, id)
+		p.internalMu.Unlock()
+	}()
+
+	request, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(id), Method: "tools/call", Params: params})
+	if err != nil {
+		return nil, err
+	}
+	if err := p.child.Write(request); err != nil {
+		return nil, err
+	}
+
+	select {
+	case response := <-waiter:
+		if response.Error != nil {
+			return nil, errors.New(response.Error.Message)
+		}
+		result := parseToolResult(response.Result)
+		if result.IsError {
+			return nil, fmt.Errorf("%s failed: %s", name, result.text())
+		}
+		return result, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%s timed out after %v", name, timeout)
+	}
+}
+
+// deliverInternal hands a response to the wrapper's own request to its waiter
+func (p *Proxy) deliverInternal(msg *rpcMessage) bool {
+	if !strings.HasPrefix(string(msg.ID), `"`+internalIDPrefix) {
+		return false
+	}
+	p.internalMu.Lock()
+	waiter, ok := p.waiters[string(msg.ID)]
+	p.internalMu.Unlock()
+	if ok {
+		waiter <- msg
+	}
+	return true
+}
+
+// toolResult is the result of a tools/call request
+type toolResult struct {
+	Content []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text,omitempty"`
+		Data     string `json:"data,omitempty"`
+		MimeType string `json:"mimeType,omitempty"`
+	} `json:"content"`
+	IsError bool `json:"isError,omitempty"`
+}
+
+func parseToolResult(raw json.RawMessage) *toolResult {
+	result := &toolResult{}
+	json.Unmarshal(raw, result)
+	return result
+}
+
+// text joins the text content of the result
+func (r *toolResult) text() string {
+	var parts []string
+	for _, content := range r.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
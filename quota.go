@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rotationLeastUtilized = "least-utilized"
+	defaultQuotaWindow    = time.Hour
+	// quotaHeartbeat is how often a running session refreshes its reservation, which
+	// lapses when it is not refreshed for quotaReservationExpiry
+	quotaHeartbeat         = 30 * time.Second
+	quotaReservationExpiry = 2 * time.Minute
+)
+
+// QuotaConfig caps what each profile of a rotation may do within a sliding window, such
+// as 100 navigations an hour per account; zero means unlimited
+type QuotaConfig struct {
+	Sessions    int `json:"sessions,omitempty"`
+	ToolCalls   int `json:"toolCalls,omitempty"`
+	Navigations int `json:"navigations,omitempty"`
+	// Window is how far back usage counts, 1h by default
+	Window Duration `json:"window,omitempty"`
+}
+
+// UsageRecord is what one session of a profile used. It is added when the session is
+// handed the profile and filled in when it ends.
+type UsageRecord struct {
+	Started     time.Time `json:"started"`
+	PID         int       `json:"pid,omitempty"`
+	ToolCalls   int       `json:"toolCalls"`
+	Navigations int       `json:"navigations"`
+	// Reserved is the quota granted to the session while it runs, which counts as used
+	// until the session records what it really used. Heartbeat is when the session last
+	// refreshed it and the counts above; the reservation of a session that stopped
+	// refreshing it lapses, and the counts stand for what it used.
+	Reserved  *BudgetConfig `json:"reserved,omitempty"`
+	Heartbeat time.Time     `json:"heartbeat,omitempty"`
+}
+
+// reserving reports whether the session's reservation still holds at now
+func (u *UsageRecord) reserving(now time.Time) bool {
+	return u.Reserved != nil && now.Sub(u.Heartbeat) < quotaReservationExpiry
+}
+
+// quotaUsage sums a profile's usage within the window
+type quotaUsage struct {
+	sessions, toolCalls, navigations int
+	// open counts the sessions still running on their reservation
+	open int
+	// oldest is the start of the oldest session still in the window
+	oldest time.Time
+}
+
+func (q *QuotaConfig) window() time.Duration {
+	if q.Window > 0 {
+		return time.Duration(q.Window)
+	}
+	return defaultQuotaWindow
+}
+
+// usage returns what the profile used within the window
+func (q *QuotaConfig) usage(record *ProfileRecord, now time.Time) quotaUsage {
+	var usage quotaUsage
+	for _, session := range record.Usage {
+		if now.Sub(session.Started) >= q.window() {
+			continue
+		}
+		usage.sessions++
+		if session.reserving(now) {
+			usage.open++
+			usage.toolCalls += max(session.Reserved.ToolCalls, session.ToolCalls)
+			usage.navigations += max(session.Reserved.Navigations, session.Navigations)
+		} else {
+			usage.toolCalls += session.ToolCalls
+			usage.navigations += session.Navigations
+		}
+		if usage.oldest.IsZero() || session.Started.Before(usage.oldest) {
+			usage.oldest = session.Started
+		}
+	}
+	return usage
+}
+
+// utilization returns the largest share of a quota the usage takes, 1 or more when a
+// quota is used up. A nil quota is never used up.
+func (q *QuotaConfig) utilization(usage quotaUsage) float64 {
+	if q == nil {
+		return 0
+	}
+	share := 0.0
+	for _, pair := range [][2]int{{usage.sessions, q.Sessions}, {usage.toolCalls, q.ToolCalls}, {usage.navigations, q.Navigations}} {
+		if pair[1] > 0 {
+			share = max(share, float64(pair[0])/float64(pair[1]))
+		}
+	}
+	return share
+}
+
+// prune drops usage that left the window, so the registry does not grow
+func (q *QuotaConfig) prune(record *ProfileRecord, now time.Time) {
+	kept := record.Usage[:0]
+	for _, session := range record.Usage {
+		if now.Sub(session.Started) < q.window() {
+			kept = append(kept, session)
+		}
+	}
+	record.Usage = kept
+}
+
+// quotaGrant is the share of its quota a session was handed with its profile
+type quotaGrant struct {
+	profile string
+	quota   *QuotaConfig
+	started time.Time
+	pid     int
+	// remaining is the share of the profile's unreserved quota the session may use
+	remaining BudgetConfig
+
+	// stats counts what the session used, once the proxy is set up
+	stats    atomic.Pointer[proxyStats]
+	stop     chan struct{}
+	finished sync.Once
+}
+
+// newQuotaGrant reserves a share of what is left of the profile's quota in the registry
+// record, net of what the profile's running sessions hold. A session takes what is left
+// divided by the session slots left in the window, or half of it without a session quota,
+// so that a concurrent session still finds some.
+func newQuotaGrant(profile string, quota *QuotaConfig, record *ProfileRecord, now time.Time) *quotaGrant {
+	quota.prune(record, now)
+	usage := quota.usage(record, now)
+	grant := &quotaGrant{profile: profile, quota: quota, started: now, pid: os.Getpid(), stop: make(chan struct{})}
+	slots := 2
+	if quota.Sessions > 0 {
+		slots = max(quota.Sessions-usage.sessions, 1)
+	}
+	share := func(limit, used int) int {
+		if limit <= 0 {
+			return 0
+		}
+		left := limit - used
+		if left <= 0 {
+			return 0
+		}
+		return max(left/slots, 1)
+	}
+	grant.remaining.ToolCalls = share(quota.ToolCalls, usage.toolCalls)
+	grant.remaining.Navigations = share(quota.Navigations, usage.navigations)
+	reserved := grant.remaining
+	record.Usage = append(record.Usage, UsageRecord{Started: now, PID: grant.pid, Reserved: &reserved, Heartbeat: now})
+	go grant.heartbeat()
+	return grant
+}
+
+// usageRecord finds the grant's record in the profile's registry record
+func (g *quotaGrant) usageRecord(record *ProfileRecord) *UsageRecord {
+	for i := range record.Usage {
+		if record.Usage[i].Started.Equal(g.started) && record.Usage[i].PID == g.pid {
+			return &record.Usage[i]
+		}
+	}
+	return nil
+}
+
+// track has the heartbeat record what stats counts. A nil grant does nothing.
+func (g *quotaGrant) track(stats *proxyStats) {
+	if g != nil {
+		g.stats.Store(stats)
+	}
+}
+
+// heartbeat refreshes the reservation, along with what the session used so far, until
+// the grant is finished
+func (g *quotaGrant) heartbeat() {
+	ticker := time.NewTicker(quotaHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			updateRegistry(func(registry *Registry) error {
+				if usage := g.usageRecord(registry.profile(g.profile)); usage != nil && usage.Reserved != nil {
+					usage.ToolCalls, usage.Navigations = g.used()
+					usage.Heartbeat = clockNow()
+				}
+				return nil
+			})
+		}
+	}
+}
+
+// used returns the tool calls and navigations counted so far
+func (g *quotaGrant) used() (int, int) {
+	stats := g.stats.Load()
+	if stats == nil {
+		return 0, 0
+	}
+	return int(stats.toolCalls.Load() - stats.toolRejections.Load()), int(stats.navigations.Load())
+}
+
+// budget returns the session budget tightened to what is left of the quota. A nil grant
+// leaves the budget as configured.
+func (g *quotaGrant) budget(config *BudgetConfig) *BudgetConfig {
+	if g == nil {
+		return config
+	}
+	budget := BudgetConfig{}
+	if config != nil {
+		budget = *config
+	}
+	tighten := func(limit *int, remaining int) {
+		if remaining > 0 && (*limit <= 0 || remaining < *limit) {
+			*limit = remaining
+		}
+	}
+	tighten(&budget.ToolCalls, g.remaining.ToolCalls)
+	tighten(&budget.Navigations, g.remaining.Navigations)
+	return &budget
+}
+
+// finish records what the session used, releasing its reservation, and returns the
+// profile's utilization after it. Only the first call records anything.
+func (g *quotaGrant) finish() (float64, error) {
+	utilization, err := -1.0, error(nil)
+	g.finished.Do(func() {
+		close(g.stop)
+		err = updateRegistry(func(registry *Registry) error {
+			record := registry.profile(g.profile)
+			now := clockNow()
+			if usage := g.usageRecord(record); usage != nil {
+				usage.ToolCalls, usage.Navigations = g.used()
+				usage.Reserved = nil
+			}
+			g.quota.prune(record, now)
+			utilization = g.quota.utilization(g.quota.usage(record, now))
+			return nil
+		})
+	})
+	return utilization, err
+}
+
+// release finishes the grant if the session did not get to, such as when it failed to
+// start. A nil grant does nothing.
+func (g *quotaGrant) release() {
+	if g != nil {
+		g.finish()
+	}
+}
+
+// runRotation implements "playwrightwrap rotation status <rotation>"
+func runRotation(args []string) int {
+	if len(args) != 2 || args[0] != "status" {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap rotation status <rotation>")
+		return 2
+	}
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	rotation, ok := config.Rotations[args[1]]
+	if !ok || rotation == nil {
+		fmt.Fprintf(os.Stderr, "Rotation %q is not configured\n", args[1])
+		return 1
+	}
+	registry, err := readRegistry()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read registry: %v\n", err)
+		return 1
+	}
+	now := clockNow()
+	quota := rotation.Quota
+	if quota == nil {
+		quota = &QuotaConfig{}
+	}
+	limit := func(used, max int) string {
+		if max <= 0 {
+			return strconv.Itoa(used)
+		}
+		return fmt.Sprintf("%d/%d", used, max)
+	}
+	fmt.Printf("%-16s %10s %12s %12s %6s  %s\n", "PROFILE", "SESSIONS", "TOOL CALLS", "NAVIGATIONS", "USED", "STATUS")
+	for _, name := range rotation.Profiles {
+		record := registry.profile(name)
+		usage := quota.usage(record, now)
+		status := "available"
+		switch {
+		case record.Quarantined != nil:
+			status = "quarantined"
+		case usage.open > 0 && quota.utilization(usage) >= 1:
+			status = fmt.Sprintf("quota reserved by %d running session(s)", usage.open)
+		case quota.utilization(usage) >= 1:
+			status = fmt.Sprintf("quota used up for %v", usage.oldest.Add(quota.window()).Sub(now).Round(time.Second))
+		case now.Sub(record.LastUsed) < time.Duration(rotation.Cooldown):
+			status = fmt.Sprintf("cooling down for %v", record.LastUsed.Add(time.Duration(rotation.Cooldown)).Sub(now).Round(time.Second))
+		}
+		fmt.Printf("%-16s %10s %12s %12s %5.0f%%  %s\n", name, limit(usage.sessions, quota.Sessions), limit(usage.toolCalls, quota.ToolCalls),
+			limit(usage.navigations, quota.Navigations), quota.utilization(usage)*100, status)
+	}
+	fmt.Printf("\nWindow: %v\n", quota.window())
+	return 0
+}
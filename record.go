@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	directionClient = "client"
+	directionServer = "server"
+)
+
+// recordEntry is one line of a recorded session (.mcpr) file
+type recordEntry struct {
+	Time    time.Time       `json:"time"`
+	From    string          `json:"from"`
+	Message json.RawMessage `json:"message"`
+}
+
+// Recorder appends every proxied MCP message to a session recording
+type Recorder struct {
+	mu       sync.Mutex
+	file     *os.File
+	w        io.WriteCloser
+	redactor *Redactor
+}
+
+// NewRecorder creates a recorder writing to path, gzipped if path ends in .gz
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file, w: newArtifactWriter(file, path)}, nil
+}
+
+// Record writes a message seen from the given side of the proxy. A nil recorder records nothing.
+func (r *Recorder) Record(from string, message []byte) {
+	if r == nil {
+		return
+	}
+	if !json.Valid(message) {
+		return
+	}
+	message = r.redactor.JSON(redactRecordings, message)
+	line, err := json.Marshal(recordEntry{Time: clockNow(), From: from, Message: message})
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(append(line, '\n'))
+}
+
+// Close closes the recording file
+func (r *Recorder) Close() {
+	if r != nil && r.file != nil {
+		r.w.Close()
+		r.file.Close()
+	}
+}
+
+// readRecording loads all entries of a recorded session, compressed or not
+func readRecording(path string) ([]recordEntry, error) {
+	file, err := openArtifact(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []recordEntry
+	lr := newLineReader(file)
+	for n := 1; ; n++ {
+		line, err := lr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var entry recordEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
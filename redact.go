@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const defaultRedaction = "[REDACTED]"
+
+// Where redaction rules are applied
+const (
+	redactLogs       = "logs"
+	redactRecordings = "recordings"
+	redactResponses  = "responses"
+)
+
+var redactTargets = []string{redactLogs, redactRecordings, redactResponses}
+
+// RedactionConfig is a named set of rules hiding sensitive values
+type RedactionConfig struct {
+	// Patterns are named regular expressions; matching text is replaced wherever it appears
+	Patterns map[string]string `json:"patterns,omitempty"`
+	// Fields are JSON field paths whose values are replaced. A plain name such as
+	// "password" matches at any depth, a dotted path such as "params.arguments.text" is
+	// anchored at the message and "*" matches any one key. Arrays are looked through.
+	Fields []string `json:"fields,omitempty"`
+	// Targets limits where the rules apply: logs, recordings, responses; all by default
+	Targets []string `json:"targets,omitempty"`
+	// Replacement is the text put in place of redacted values, [REDACTED] by default
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// builtinRedactions can be referenced by name without defining them
+var builtinRedactions = map[string]*RedactionConfig{
+	"credentials": {
+		Patterns: map[string]string{
+			"bearer":     `(?i)\bbearer\s+[a-z0-9._~+/-]+=*`,
+			"basic":      `(?i)\bbasic\s+[a-z0-9+/]{8,}=*`,
+			"jwt":        `\beyJ[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+\.[a-zA-Z0-9_-]+`,
+			"aws-key-id": `\b(AKIA|ASIA)[A-Z0-9]{16}\b`,
+		},
+		Fields: []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "cookie", "authorization"},
+	},
+}
+
+// redactionRule is one compiled rule of a set
+type redactionRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	field       []string
+	anchored    bool
+	replacement string
+	targets     map[string]bool
+}
+
+// Redactor applies the redaction sets selected by a profile
+type Redactor struct {
+	rules []redactionRule
+}
+
+// NewRedactor compiles the named sets, looking them up in the config and then among the
+// built-in sets. It returns nil when no set is selected.
+func NewRedactor(config *Config, names []string) (*Redactor, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	r := &Redactor{}
+	for _, name := range names {
+		set, ok := config.Redactions[name]
+		if !ok {
+			if set, ok = builtinRedactions[name]; !ok {
+				return nil, fmt.Errorf("unknown redaction set %q", name)
+			}
+		}
+		replacement := set.Replacement
+		if replacement == "" {
+			replacement = defaultRedaction
+		}
+		targets := make(map[string]bool)
+		for _, target := range set.Targets {
+			if !isRedactTarget(target) {
+				return nil, fmt.Errorf("unknown target %q in redaction set %s, expected %s", target, name, strings.Join(redactTargets, ", "))
+			}
+			targets[target] = true
+		}
+		if len(targets) == 0 {
+			for _, target := range redactTargets {
+				targets[target] = true
+			}
+		}
+		patternNames := make([]string, 0, len(set.Patterns))
+		for patternName := range set.Patterns {
+			patternNames = append(patternNames, patternName)
+		}
+		sort.Strings(patternNames)
+		for _, patternName := range patternNames {
+			re, err := regexp.Compile(set.Patterns[patternName])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s in redaction set %s: %v", patternName, name, err)
+			}
+			r.rules = append(r.rules, redactionRule{name: name + "/" + patternName, pattern: re, replacement: replacement, targets: targets})
+		}
+		for _, field := range set.Fields {
+			path := strings.Split(field, ".")
+			r.rules = append(r.rules, redactionRule{name: name + "/" + field, field: path, anchored: len(path) > 1, replacement: replacement, targets: targets})
+		}
+	}
+	return r, nil
+}
+
+func isRedactTarget(target string) bool {
+	for _, known := range redactTargets {
+		if target == known {
+			return true
+		}
+	}
+	return false
+}
+
+// String redacts free text for the target. A nil redactor returns text unchanged.
+func (r *Redactor) String(target string, text string) string {
+	if r == nil {
+		return text
+	}
+	return r.redactText(target, text, nil)
+}
+
+// JSON redacts a JSON message for the target, treating it as text if it is not valid JSON.
+// A nil redactor returns data unchanged.
+func (r *Redactor) JSON(target string, data []byte) []byte {
+	if r == nil {
+		return data
+	}
+	redacted, _ := r.redact(target, data)
+	return redacted
+}
+
+// redact redacts data and counts the hits of each rule
+func (r *Redactor) redact(target string, data []byte) ([]byte, map[string]int) {
+	hits := make(map[string]int)
+	value, err := decodeExact(data)
+	if err != nil {
+		return []byte(r.redactText(target, string(data), hits)), hits
+	}
+	value = r.redactValue(target, value, nil, hits)
+	if len(hits) == 0 {
+		return data, hits
+	}
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if encoder.Encode(value) != nil {
+		return data, hits
+	}
+	return []byte(strings.TrimSuffix(buf.String(), "\n")), hits
+}
+
+// decodeExact decodes a JSON value keeping numbers as json.Number, so that integers
+// beyond 2^53, such as IDs, are written back unchanged
+func decodeExact(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("data after the JSON value")
+	}
+	return value, nil
+}
+
+func (r *Redactor) redactValue(target string, value interface{}, path []string, hits map[string]int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := append(append([]string(nil), path...), key)
+			if rule := r.fieldRule(target, childPath); rule != nil {
+				hits[rule.name]++
+				v[key] = rule.replacement
+				continue
+			}
+			v[key] = r.redactValue(target, child, childPath, hits)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.redactValue(target, child, path, hits)
+		}
+		return v
+	case string:
+		return r.redactText(target, v, hits)
+	}
+	return value
+}
+
+// fieldRule returns the field rule matching the path of a JSON value
+func (r *Redactor) fieldRule(target string, path []string) *redactionRule {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.field == nil || !rule.targets[target] {
+			continue
+		}
+		if rule.anchored {
+			if len(rule.field) == len(path) && matchFieldPath(rule.field, path) {
+				return rule
+			}
+		} else if strings.EqualFold(rule.field[0], path[len(path)-1]) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func matchFieldPath(pattern []string, path []string) bool {
+	for i := range pattern {
+		if pattern[i] != "*" && !strings.EqualFold(pattern[i], path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Redactor) redactText(target string, text string, hits map[string]int) string {
+	for _, rule := range r.rules {
+		if rule.pattern == nil || !rule.targets[target] {
+			continue
+		}
+		matches := rule.pattern.FindAllStringIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if hits != nil {
+			hits[rule.name] += len(matches)
+		}
+		text = rule.pattern.ReplaceAllLiteralString(text, rule.replacement)
+	}
+	return text
+}
+
+// runRedaction implements "playwrightwrap redaction <subcommand>"
+func runRedaction(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap redaction test [--profile name] [--set name] [--target name] [text]")
+		return 2
+	}
+	return runRedactionTest(args[1:])
+}
+
+// runRedactionTest redacts the given text, or stdin, with a profile's sets and shows
+// which rules matched
+func runRedactionTest(args []string) int {
+	flags := flag.NewFlagSet("redaction test", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile whose redaction sets are used")
+	var sets stringList
+	flags.Var(&sets, "set", "redaction set to use instead of the profile's, repeatable")
+	target := flags.String("target", redactLogs, "target to test: "+strings.Join(redactTargets, ", "))
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !isRedactTarget(*target) {
+		fmt.Fprintf(os.Stderr, "Unknown target %q, expected %s\n", *target, strings.Join(redactTargets, ", "))
+		return 2
+	}
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	names := []string(sets)
+	if len(names) == 0 {
+		names = config.Profile(*profile).Redaction
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "Profile %s selects no redaction sets, pass --set\n", *profile)
+		return 1
+	}
+	redactor, err := NewRedactor(config, names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+		return 1
+	}
+	input := []byte(strings.Join(flags.Args(), " "))
+	if flags.NArg() == 0 {
+		if input, err = io.ReadAll(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			return 1
+		}
+	}
+	output, hits := redactor.redact(*target, []byte(strings.TrimRight(string(input), "\n")))
+	fmt.Println(string(output))
+	if len(hits) == 0 {
+		fmt.Fprintln(os.Stderr, "No rule matched")
+		return 0
+	}
+	rules := make([]string, 0, len(hits))
+	for rule := range hits {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		fmt.Fprintf(os.Stderr, "  %s: %d\n", rule, hits[rule])
+	}
+	return 0
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	registryFile     = "registry.json"
+	registryLockWait = 10 * time.Second
+)
+
+// Registry is the state shared by all wrapper sessions on this machine
+type Registry struct {
+	Profiles  map[string]*ProfileRecord  `json:"profiles,omitempty"`
+	Rotations map[string]*RotationRecord `json:"rotations,omitempty"`
+}
+
+// ProfileRecord tracks how a profile has been used
+type ProfileRecord struct {
+	Uses     int       `json:"uses"`
+	LastUsed time.Time `json:"lastUsed,omitempty"`
+	// Crashes are the recent times the profile's child crashed
+	Crashes     []time.Time `json:"crashes,omitempty"`
+	Quarantined *Quarantine `json:"quarantined,omitempty"`
+	// StateChecksum is the SHA-256 of the storage state last written back by a session
+	StateChecksum  string    `json:"stateChecksum,omitempty"`
+	StateWrittenBy string    `json:"stateWrittenBy,omitempty"`
+	StateWrittenAt time.Time `json:"stateWrittenAt,omitempty"`
+	// Usage is what the profile's sessions used, kept for the rotation quota's window
+	Usage []UsageRecord `json:"usage,omitempty"`
+}
+
+// RotationRecord holds the position of a round-robin rotation
+type RotationRecord struct {
+	Next int `json:"next"`
+}
+
+// profile returns the record of a profile, creating it if needed
+func (r *Registry) profile(name string) *ProfileRecord {
+	if r.Profiles == nil {
+		r.Profiles = make(map[string]*ProfileRecord)
+	}
+	record, ok := r.Profiles[name]
+	if !ok {
+		record = &ProfileRecord{}
+		r.Profiles[name] = record
+	}
+	return record
+}
+
+// rotation returns the record of a rotation, creating it if needed
+func (r *Registry) rotation(name string) *RotationRecord {
+	if r.Rotations == nil {
+		r.Rotations = make(map[string]*RotationRecord)
+	}
+	record, ok := r.Rotations[name]
+	if !ok {
+		record = &RotationRecord{}
+		r.Rotations[name] = record
+	}
+	return record
+}
+
+// registryPath returns the location of the registry file
+func registryPath() string {
+	return filepath.Join(sessionTmpDir(), registryFile)
+}
+
+// readRegistry loads the registry without locking it, for read-only use
+func readRegistry() (*Registry, error) {
+	registry := &Registry{}
+	data, err := os.ReadFile(registryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return registry, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("invalid registry %s: %v", registryPath(), err)
+	}
+	return registry, nil
+}
+
+// updateRegistry loads the registry under an exclusive lock, lets fn modify it and writes it back
+func updateRegistry(fn func(registry *Registry) error) error {
+	path := registryPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := readRegistry()
+	if err != nil {
+		return err
+	}
+	if err := fn(registry); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// lockFile takes a lock by exclusively creating lockPath. Locks older than
+// registryLockWait are considered abandoned by a crashed session and broken.
+func lockFile(lockPath string) (func(), error) {
+	deadline := time.Now().Add(registryLockWait)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > registryLockWait {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
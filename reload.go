@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+const configPollInterval = 2 * time.Second
+
+// proxyPolicies are the proxy settings that can be reloaded while the session runs
+type proxyPolicies struct {
+	policy   *Policy
+	urls     *URLPolicy
+	throttle *Throttle
+	tools    *ToolOverrides
+}
+
+// newProxyPolicies builds the reloadable settings of a profile. network is what the child
+// was started with, the URL policy has to agree with it.
+func newProxyPolicies(config *Config, profile *ProfileConfig, network *NetworkConfig) (*proxyPolicies, error) {
+	policy, err := NewPolicy(profile.Policy)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := NewURLPolicy(network, profile.Policy)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := NewToolOverrides(config, profile.Tools)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyPolicies{policy: policy, urls: urls, throttle: NewThrottle(profile.Throttle), tools: tools}, nil
+}
+
+// ConfigReloader applies policy changes from the config file to a running session
+type ConfigReloader struct {
+	path    string
+	profile string
+	proxy   *Proxy
+	logger  *Logger
+	// network is fixed by the child's flags for the whole session
+	network *NetworkConfig
+
+	modTime time.Time
+	stop    chan struct{}
+}
+
+// NewConfigReloader creates a reloader for the session's profile
+func NewConfigReloader(path string, profile string, network *NetworkConfig, proxy *Proxy, logger *Logger) *ConfigReloader {
+	r := &ConfigReloader{path: path, profile: profile, network: network, proxy: proxy, logger: logger, stop: make(chan struct{})}
+	if info, err := os.Stat(path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return r
+}
+
+// Reload reads the config file again and swaps in the profile's policies. The old
+// policies stay in force if the new config is invalid.
+func (r *ConfigReloader) Reload() error {
+	config, err := LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+	profile := config.Profile(r.profile)
+	policies, err := newProxyPolicies(config, profile, r.network)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(profile.Network, r.network) {
+		r.logger.Log("Network settings of profile %s changed, they apply from the next session", r.profile)
+		fmt.Fprintf(os.Stderr, "playwrightwrap: network settings of profile %s changed, they apply from the next session\n", r.profile)
+	}
+	r.proxy.policies.Store(policies)
+	r.logger.Log("Reloaded policies of profile %s from %s", r.profile, r.path)
+	return nil
+}
+
+// Watch reloads whenever the config file changes, until Stop
+func (r *ConfigReloader) Watch() {
+	go func() {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(r.path)
+			if err != nil || info.ModTime().Equal(r.modTime) {
+				continue
+			}
+			r.modTime = info.ModTime()
+			if err := r.Reload(); err != nil {
+				r.logger.Log("Config reload failed, keeping the previous policies: %v", err)
+				fmt.Fprintf(os.Stderr, "playwrightwrap: config reload failed, keeping the previous policies: %v\n", err)
+			}
+		}
+	}()
+}
+
+// Stop ends watching. A nil reloader does nothing.
+func (r *ConfigReloader) Stop() {
+	if r != nil {
+		close(r.stop)
+	}
+}
+
+// register adds the reload command to the control socket
+func (r *ConfigReloader) register(control *ControlServer) {
+	control.Handle("reload", func(*controlRequest) (interface{}, error) {
+		return nil, r.Reload()
+	})
+}
+
+// runReload implements "playwrightwrap reload", making a running session reread its
+// policies from the config file
+func runReload(args []string) int {
+	flags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket of the session, found automatically when only one is running")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	path, err := findControlSocket(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		return 1
+	}
+	if _, err := controlCall(path, &controlRequest{Command: "reload"}); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reload: %v\n", err)
+		return 1
+	}
+	return 0
+}
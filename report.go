@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const reportTextLimit = 2000
+
+// reportCall is one tool call in the report timeline
+type reportCall struct {
+	Offset    string
+	Tool      string
+	Arguments string
+	Duration  string
+	Error     string
+	Text      string
+	Images    []template.URL
+}
+
+// reportNavigation is one navigation target of the session
+type reportNavigation struct {
+	Offset string
+	URL    string
+}
+
+// stateChange is a difference between two storage states
+type stateChange struct {
+	Kind string
+	Item string
+}
+
+// reportData is what the HTML report template renders
+type reportData struct {
+	Source      string
+	Started     string
+	Duration    string
+	Calls       []*reportCall
+	Errors      int
+	Navigations []reportNavigation
+	StateDiff   []stateChange
+	HasDiff     bool
+}
+
+// runReport implements "playwrightwrap report", rendering a session recording as a
+// self-contained HTML page or a Markdown transcript
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := flags.String("format", "html", "output format: html, or markdown for a transcript to paste into tickets")
+	output := flags.String("output", "", "file to write, the recording path with .html or .md by default")
+	images := flags.String("images", "", "directory for the screenshots a markdown transcript links, next to it by default")
+	before := flags.String("before", "", "storage state from before the session, for the state diff")
+	after := flags.String("after", "", "storage state from after the session, for the state diff")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap report [flags] <recording.mcpr>")
+		return 2
+	}
+	source := flags.Arg(0)
+	ext := ".html"
+	switch *format {
+	case "html":
+	case "markdown":
+		ext = ".md"
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported format %q, expected html or markdown\n", *format)
+		return 2
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(strings.TrimSuffix(source, gzipSuffix), ".mcpr") + ext
+	}
+	if *images == "" {
+		*images = strings.TrimSuffix(*output, filepath.Ext(*output)) + "-images"
+	}
+
+	entries, err := readRecording(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read recording: %v\n", err)
+		return 1
+	}
+	data := buildReport(source, entries)
+	if *before != "" || *after != "" {
+		diff, err := diffStateFiles(*before, *after)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compare storage states: %v\n", err)
+			return 1
+		}
+		data.StateDiff, data.HasDiff = diff, true
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create report: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+	if *format == "markdown" {
+		err = writeTranscript(file, data, filepath.Dir(*output), *images)
+	} else {
+		err = reportTemplate.Execute(file, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Report written to %s\n", *output)
+	return 0
+}
+
+// buildReport pairs the recorded tool calls with their results
+func buildReport(source string, entries []recordEntry) *reportData {
+	data := &reportData{Source: source}
+	if len(entries) == 0 {
+		return data
+	}
+	start := entries[0].Time
+	data.Started = start.Format(time.RFC3339)
+	data.Duration = entries[len(entries)-1].Time.Sub(start).Round(time.Millisecond).String()
+	offset := func(t time.Time) string {
+		return "+" + t.Sub(start).Round(time.Millisecond).String()
+	}
+
+	type inflight struct {
+		call *reportCall
+		sent time.Time
+	}
+	pending := make(map[string]inflight)
+	for _, entry := range entries {
+		var msg rpcMessage
+		if err := json.Unmarshal(entry.Message, &msg); err != nil {
+			continue
+		}
+		switch {
+		case entry.From == directionClient && msg.isRequest() && msg.Method == "tools/call":
+			var params toolCall
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				continue
+			}
+			call := &reportCall{Offset: offset(entry.Time), Tool: params.Name, Arguments: formatArguments(params.Arguments)}
+			data.Calls = append(data.Calls, call)
+			pending[string(msg.ID)] = inflight{call, entry.Time}
+			if params.Name == "browser_navigate" {
+				data.Navigations = append(data.Navigations, reportNavigation{call.Offset, params.stringArg("url")})
+			}
+		case entry.From == directionServer && msg.isResponse():
+			request, ok := pending[string(msg.ID)]
+			if !ok {
+				continue
+			}
+			delete(pending, string(msg.ID))
+			call := request.call
+			call.Duration = entry.Time.Sub(request.sent).Round(time.Millisecond).String()
+			if msg.Error != nil {
+				call.Error = msg.Error.Message
+				data.Errors++
+				continue
+			}
+			result := parseToolResult(msg.Result)
+			call.Text = truncate(result.text(), reportTextLimit)
+			if result.IsError {
+				call.Error = call.Text
+				data.Errors++
+			}
+			for _, content := range result.Content {
+				if content.Type == "image" && strings.HasPrefix(content.MimeType, "image/") {
+					call.Images = append(call.Images, template.URL("data:"+content.MimeType+";base64,"+content.Data))
+				}
+			}
+		}
+	}
+	for _, request := range pending {
+		request.call.Error = "no response recorded"
+		data.Errors++
+	}
+	return data
+}
+
+// formatArguments renders tool arguments as indented JSON; the template does the HTML escaping
+func formatArguments(arguments map[string]interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(arguments)
+	return strings.TrimSpace(buf.String())
+}
+
+// truncate cuts s to at most limit bytes, backing off to the start of a character so a
+// multibyte one is not split
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit] + "\n…"
+}
+
+// diffStateFiles compares two storage state files; an empty path stands for an empty state
+func diffStateFiles(beforePath, afterPath string) ([]stateChange, error) {
+	load := func(path string) (*StorageState, error) {
+		if path == "" {
+			return &StorageState{}, nil
+		}
+		return loadStorageState(path)
+	}
+	before, err := load(beforePath)
+	if err != nil {
+		return nil, err
+	}
+	after, err := load(afterPath)
+	if err != nil {
+		return nil, err
+	}
+	return diffStorageState(before, after), nil
+}
+
+// diffStorageState lists the cookies and localStorage entries added, removed or changed
+func diffStorageState(before, after *StorageState) []stateChange {
+	flatten := func(state *StorageState) map[string]string {
+		items := make(map[string]string)
+		for _, c := range state.Cookies {
+			items[fmt.Sprintf("cookie %s on %s%s", c.Name, c.Domain, c.Path)] = fmt.Sprintf("%s|%v", c.Value, c.Expires)
+		}
+		for _, origin := range state.Origins {
+			for _, entry := range origin.LocalStorage {
+				items[fmt.Sprintf("localStorage %s on %s", entry.Name, origin.Origin)] = entry.Value
+			}
+		}
+		return items
+	}
+	old, current := flatten(before), flatten(after)
+	var changes []stateChange
+	for item, value := range current {
+		previous, ok := old[item]
+		switch {
+		case !ok:
+			changes = append(changes, stateChange{"added", item})
+		case previous != value:
+			changes = append(changes, stateChange{"changed", item})
+		}
+	}
+	for item := range old {
+		if _, ok := current[item]; !ok {
+			changes = append(changes, stateChange{"removed", item})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Item < changes[j].Item })
+	return changes
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Session report: {{.Source}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+tr.error td { background: #fdecea; }
+pre { white-space: pre-wrap; margin: 0; max-height: 20em; overflow: auto; font-size: 0.85em; }
+img { max-width: 240px; border: 1px solid #ccc; margin: 2px; }
+.added { color: #1a7f37; } .removed { color: #cf222e; } .changed { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Session report</h1>
+<p>Recording <code>{{.Source}}</code>{{if .Started}}, started {{.Started}}, lasted {{.Duration}}{{end}}.
+{{len .Calls}} tool call(s), {{.Errors}} error(s), {{len .Navigations}} navigation(s).</p>
+
+<h2>Navigations</h2>
+{{if .Navigations}}<table>
+<tr><th>Time</th><th>URL</th></tr>
+{{range .Navigations}}<tr><td>{{.Offset}}</td><td>{{.URL}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h2>Timeline</h2>
+{{if .Calls}}<table>
+<tr><th>Time</th><th>Tool</th><th>Arguments</th><th>Duration</th><th>Result</th></tr>
+{{range .Calls}}<tr{{if .Error}} class="error"{{end}}>
+<td>{{.Offset}}</td><td>{{.Tool}}</td><td><pre>{{.Arguments}}</pre></td><td>{{.Duration}}</td>
+<td>{{if .Error}}<strong>Error:</strong><pre>{{.Error}}</pre>{{else}}<pre>{{.Text}}</pre>{{end}}{{range .Images}}<a href="{{.}}"><img src="{{.}}"></a>{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>No tool calls.</p>{{end}}
+
+{{if .HasDiff}}<h2>State changes</h2>
+{{if .StateDiff}}<ul>
+{{range .StateDiff}}<li class="{{.Kind}}">{{.Kind}}: {{.Item}}</li>
+{{end}}</ul>{{else}}<p>No changes.</p>{{end}}{{end}}
+</body>
+</html>
+`))
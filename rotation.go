@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	rotationRoundRobin = "round-robin"
+	rotationLRU        = "least-recently-used"
+)
+
+// selectProfile picks the profile for this session from the named rotation and
+// records its use in the registry. With a quota, the grant tells what the session may
+// still use and records what it did; it is nil otherwise.
+func selectProfile(config *Config, rotationName string) (string, *quotaGrant, error) {
+	rotation, ok := config.Rotations[rotationName]
+	if !ok || rotation == nil || len(rotation.Profiles) == 0 {
+		return "", nil, fmt.Errorf("rotation %q is not configured or has no profiles", rotationName)
+	}
+	policy := rotation.Policy
+	if policy == "" {
+		policy = rotationRoundRobin
+	}
+	if policy != rotationRoundRobin && policy != rotationLRU && policy != rotationLeastUtilized {
+		return "", nil, fmt.Errorf("rotation %q: unknown policy %q, expected %s, %s or %s", rotationName, policy, rotationRoundRobin, rotationLRU, rotationLeastUtilized)
+	}
+	if policy == rotationLeastUtilized && rotation.Quota == nil {
+		return "", nil, fmt.Errorf("rotation %q: the %s policy needs a quota", rotationName, rotationLeastUtilized)
+	}
+
+	var selected string
+	var grant *quotaGrant
+	err := updateRegistry(func(registry *Registry) error {
+		now := clockNow()
+		cooldown := time.Duration(rotation.Cooldown)
+		available := func(name string) bool {
+			record := registry.profile(name)
+			// A quarantined profile would refuse to start, the rotation moves past it
+			if record.Quarantined != nil || now.Sub(record.LastUsed) < cooldown {
+				return false
+			}
+			return rotation.Quota == nil || rotation.Quota.utilization(rotation.Quota.usage(record, now)) < 1
+		}
+
+		switch policy {
+		case rotationRoundRobin:
+			record := registry.rotation(rotationName)
+			for i := 0; i < len(rotation.Profiles); i++ {
+				index := (record.Next + i) % len(rotation.Profiles)
+				if available(rotation.Profiles[index]) {
+					selected = rotation.Profiles[index]
+					record.Next = index + 1
+					break
+				}
+			}
+		case rotationLRU:
+			for _, name := range rotation.Profiles {
+				if available(name) && (selected == "" || registry.profile(name).LastUsed.Before(registry.profile(selected).LastUsed)) {
+					selected = name
+				}
+			}
+		case rotationLeastUtilized:
+			least := 0.0
+			for _, name := range rotation.Profiles {
+				if !available(name) {
+					continue
+				}
+				record := registry.profile(name)
+				utilization := rotation.Quota.utilization(rotation.Quota.usage(record, now))
+				if selected == "" || utilization < least || (utilization == least && record.LastUsed.Before(registry.profile(selected).LastUsed)) {
+					selected, least = name, utilization
+				}
+			}
+		}
+
+		if selected == "" {
+			quarantined := 0
+			for _, name := range rotation.Profiles {
+				if registry.profile(name).Quarantined != nil {
+					quarantined++
+				}
+			}
+			if quarantined == len(rotation.Profiles) {
+				return fmt.Errorf("all profiles of rotation %q are quarantined, release them with `playwrightwrap profiles release <profile>`", rotationName)
+			}
+			return fmt.Errorf("all profiles of rotation %q are quarantined, cooling down or used up their quota, next one is available in %v",
+				rotationName, nextAvailable(registry, rotation, now).Round(time.Second))
+		}
+		record := registry.profile(selected)
+		record.Uses++
+		record.LastUsed = now
+		if rotation.Quota != nil {
+			grant = newQuotaGrant(selected, rotation.Quota, record, now)
+		}
+		return nil
+	})
+	return selected, grant, err
+}
+
+// nextAvailable returns how long until a profile of the rotation leaves its cooldown and
+// has quota again
+func nextAvailable(registry *Registry, rotation *RotationConfig, now time.Time) time.Duration {
+	soonest := time.Duration(-1)
+	for _, name := range rotation.Profiles {
+		record := registry.profile(name)
+		if record.Quarantined != nil {
+			continue
+		}
+		wait := record.LastUsed.Add(time.Duration(rotation.Cooldown)).Sub(now)
+		if quota := rotation.Quota; quota != nil {
+			if usage := quota.usage(record, now); quota.utilization(usage) >= 1 {
+				wait = max(wait, usage.oldest.Add(quota.window()).Sub(now))
+			}
+		}
+		if soonest < 0 || wait < soonest {
+			soonest = wait
+		}
+	}
+	return soonest
+}
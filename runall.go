@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultRunAllHost keeps TCP endpoints to this machine unless --host or --interface says otherwise
+const defaultRunAllHost = "127.0.0.1"
+
+// runAllEndpoint is one profile's wrapper and the listener its client connects to. The
+// stdio transport is carried over the connection unchanged, one JSON message per line.
+type runAllEndpoint struct {
+	profile  string
+	endpoint string
+	listener net.Listener
+	// tokens admits clients of a TCP endpoint, nil when any client may connect
+	tokens runAllTokens
+	// cmd is nil for a wrapper adopted from another run-all, which cannot be waited for
+	cmd     *exec.Cmd
+	process *os.Process
+	stdin   *os.File
+	stdout  *os.File
+	stderr  *os.File
+	// out reads the wrapper's messages; partial is the start of a message whose read
+	// was cut off by pause
+	out     *bufio.Reader
+	partial []byte
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pausing bool
+	// running counts the goroutines moving the endpoint's data
+	running sync.WaitGroup
+}
+
+// runAllMapping is printed once every wrapper is listening
+type runAllMapping struct {
+	Profiles map[string]runAllProfile `json:"profiles"`
+}
+
+type runAllProfile struct {
+	Endpoint string `json:"endpoint"`
+	PID      int    `json:"pid"`
+}
+
+// runRunAll implements "playwrightwrap run-all", starting one wrapper per profile and
+// supervising them together. With --takeover it adopts the listeners and wrappers of a
+// running run-all instead, so the wrapper can be upgraded without ending the sessions.
+func runRunAll(args []string) int {
+	flags := flag.NewFlagSet("run-all", flag.ContinueOnError)
+	profileList := flags.String("profiles", "", "comma separated profiles to start (required)")
+	port := flags.Int("port", 0, "first TCP port, profiles listen on consecutive ports; unix sockets when 0")
+	host := flags.String("host", "", "address the TCP endpoints listen on, such as ::1 or 0.0.0.0; "+defaultRunAllHost+" by default")
+	iface := flags.String("interface", "", "listen on the first address of this network interface instead of --host")
+	allowRemote := flags.Bool("allow-remote", false, "allow a non-loopback --host or --interface")
+	tokensFile := flags.String("tokens", "", "JSON file of client identities and their tokens, which TCP clients send first; required with --allow-remote")
+	takeover := flags.Int("takeover", 0, "PID of a running run-all whose sessions to adopt instead of starting new ones")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	profiles := splitList(*profileList)
+	if len(profiles) == 0 && *takeover == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap run-all --profiles a,b,c [--port N [--host addr | --interface name] [--allow-remote] [--tokens file]] [-- playwright args]")
+		fmt.Fprintln(os.Stderr, "       playwrightwrap run-all --takeover PID")
+		return 2
+	}
+	bindAddress, err := bindHost(*host, *iface)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid bind address: %v\n", err)
+		return 2
+	}
+	if *port == 0 && (*host != "" || *iface != "") {
+		fmt.Fprintln(os.Stderr, "--host and --interface need --port")
+		return 2
+	}
+	// The endpoints are bare MCP streams, whoever connects drives the profile's browser
+	if *port != 0 && !isLoopbackHost(bindAddress) {
+		if !*allowRemote {
+			fmt.Fprintf(os.Stderr, "run-all would listen on %s, which is not a loopback address, without TLS or authentication; pass --allow-remote to accept that\n", bindAddress)
+			return 2
+		}
+		// Other machines may connect, so every client has to present a token
+		if *tokensFile == "" {
+			fmt.Fprintf(os.Stderr, "run-all on %s, which is not a loopback address, needs --tokens so that clients authenticate\n", bindAddress)
+			return 2
+		}
+		warnExposed("run-all", bindAddress)
+	}
+	var tokens runAllTokens
+	if *tokensFile != "" {
+		if tokens, err = loadRunAllTokens(*tokensFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load tokens: %v\n", err)
+			return 2
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the wrapper executable: %v\n", err)
+		return 1
+	}
+	// The directory holds the unix sockets and the takeover socket
+	socketDir := runAllDir(os.Getpid())
+	if err := os.MkdirAll(socketDir, 0700); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create socket directory: %v\n", err)
+		return 1
+	}
+	socketDirs := []string{socketDir}
+
+	var endpoints []*runAllEndpoint
+	handedOff := false
+	defer func() {
+		// After a takeover the sockets and wrappers belong to the new run-all
+		if handedOff {
+			return
+		}
+		for _, e := range endpoints {
+			e.listener.Close()
+		}
+		for _, dir := range socketDirs {
+			os.RemoveAll(dir)
+		}
+	}()
+	if *takeover != 0 {
+		adopted, dirs, err := adoptRunAll(*takeover)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to take over run-all %d: %v\n", *takeover, err)
+			return 1
+		}
+		endpoints = adopted
+		socketDirs = append(socketDirs, dirs...)
+		fmt.Fprintf(os.Stderr, "playwrightwrap: took over %d session(s) from run-all %d\n", len(endpoints), *takeover)
+	}
+	seen := make(map[string]bool)
+	for i, profile := range profiles {
+		if *takeover != 0 {
+			break
+		}
+		if seen[profile] {
+			fmt.Fprintf(os.Stderr, "Profile %s is listed twice\n", profile)
+			return 2
+		}
+		seen[profile] = true
+		e := &runAllEndpoint{profile: profile}
+		if *port != 0 {
+			e.tokens = tokens
+		}
+		if *port == 0 {
+			path := filepath.Join(socketDir, profile+".sock")
+			e.listener, err = net.Listen("unix", path)
+			e.endpoint = "unix://" + path
+		} else {
+			address := net.JoinHostPort(bindAddress, strconv.Itoa(*port+i))
+			e.listener, err = net.Listen("tcp", address)
+			e.endpoint = "tcp://" + address
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to listen for profile %s: %v\n", profile, err)
+			return 1
+		}
+		endpoints = append(endpoints, e)
+		if err := e.start(self, flags.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start profile %s: %v\n", profile, err)
+			stopEndpoints(endpoints)
+			return 1
+		}
+	}
+	mapping := runAllMapping{Profiles: make(map[string]runAllProfile)}
+	for _, e := range endpoints {
+		mapping.Profiles[e.profile] = runAllProfile{Endpoint: e.endpoint, PID: e.process.Pid}
+	}
+	data, _ := json.Marshal(mapping)
+	fmt.Println(string(data))
+
+	// A newer run-all can take the sessions over through the takeover socket
+	handoff := make(chan struct{})
+	if takeoverSupported {
+		listener, err := net.Listen("unix", filepath.Join(socketDir, takeoverSocketFile))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "playwrightwrap: takeover is not available: %v\n", err)
+		} else {
+			defer listener.Close()
+			go serveTakeover(listener, endpoints, socketDirs, handoff)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	go func() {
+		// The first signal ends the sessions like a client hanging up, so state is
+		// saved; a second one is forwarded to the wrappers
+		sig := <-sigChan
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v, stopping %d session(s)\n", sig, len(endpoints))
+		for _, e := range endpoints {
+			e.stdin.Close()
+		}
+		for sig := range sigChan {
+			for _, e := range endpoints {
+				e.process.Signal(sig)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(endpoints))
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.run()
+			codes[i] = e.wait()
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-handoff:
+		handedOff = true
+		fmt.Fprintf(os.Stderr, "playwrightwrap: handed %d session(s) over, exiting\n", len(endpoints))
+		return 0
+	}
+	exitCode := 0
+	for _, code := range codes {
+		exitCode = max(exitCode, code)
+	}
+	return exitCode
+}
+
+// start launches the wrapper of the endpoint's profile. Its stdio are plain pipes, so
+// they can be handed to another run-all.
+func (e *runAllEndpoint) start(self string, args []string) error {
+	e.cmd = exec.Command(self, args...)
+	env := []string{"PLAYWRIGHTWRAP_PROFILE=" + e.profile}
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, "PLAYWRIGHTWRAP_ROTATION=") && !strings.HasPrefix(variable, "PLAYWRIGHTWRAP_PROFILE=") {
+			env = append(env, variable)
+		}
+	}
+	e.cmd.Env = env
+	var ends [6]*os.File
+	for i := 0; i < len(ends); i += 2 {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeFiles(ends[:i]...)
+			return err
+		}
+		ends[i], ends[i+1] = r, w
+	}
+	e.cmd.Stdin, e.cmd.Stdout, e.cmd.Stderr = ends[0], ends[3], ends[5]
+	err := e.cmd.Start()
+	closeFiles(ends[0], ends[3], ends[5])
+	if err != nil {
+		closeFiles(ends[1], ends[2], ends[4])
+		return err
+	}
+	e.stdin, e.stdout, e.stderr = ends[1], ends[2], ends[4]
+	e.out = bufio.NewReaderSize(e.stdout, 64*1024)
+	e.process = e.cmd.Process
+	return nil
+}
+
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// stopEndpoints ends the wrappers started so far
+func stopEndpoints(endpoints []*runAllEndpoint) {
+	for _, other := range endpoints {
+		if other.cmd != nil && other.cmd.Process != nil {
+			other.stdin.Close()
+			other.cmd.Wait()
+			closeFiles(other.stdout, other.stderr)
+		}
+	}
+}
+
+// run starts moving the endpoint's data: clients to the wrapper, the wrapper's messages
+// to the client and its stderr to ours
+func (e *runAllEndpoint) run() {
+	e.mu.Lock()
+	conn := e.conn
+	e.mu.Unlock()
+	e.running.Add(3)
+	go e.serve()
+	go e.relay()
+	go e.copyStderr()
+	if conn != nil {
+		e.running.Add(1)
+		go e.copyClient(conn)
+	}
+}
+
+// serve accepts clients and admits one at a time. A client that reconnects continues the
+// same MCP session.
+func (e *runAllEndpoint) serve() {
+	defer e.running.Done()
+	for {
+		conn, err := e.listener.Accept()
+		if err != nil {
+			return
+		}
+		go e.admit(conn)
+	}
+}
+
+// admit authenticates a client of an endpoint with tokens and then copies its messages
+// to the wrapper, unless another client is connected
+func (e *runAllEndpoint) admit(conn net.Conn) {
+	if e.tokens != nil {
+		identity, err := e.tokens.authenticate(conn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "playwrightwrap: refused a client of profile %s from %s: %v\n", e.profile, conn.RemoteAddr(), err)
+			fmt.Fprintln(conn, "playwrightwrap: authentication failed")
+			conn.Close()
+			return
+		}
+		fmt.Fprintf(os.Stderr, "playwrightwrap: client %s connected to profile %s from %s\n", identity, e.profile, conn.RemoteAddr())
+	}
+	e.mu.Lock()
+	busy, pausing := e.conn != nil, e.pausing
+	if !busy && !pausing {
+		e.conn = conn
+		e.running.Add(1)
+	}
+	e.mu.Unlock()
+	if busy || pausing {
+		reason := "already has a client"
+		if pausing {
+			reason = "is being handed over, connect again"
+		}
+		fmt.Fprintf(conn, "playwrightwrap: profile %s %s\n", e.profile, reason)
+		conn.Close()
+		return
+	}
+	e.copyClient(conn)
+}
+
+// copyClient copies the client's messages to the wrapper until the client hangs up or
+// the endpoint is paused, which keeps the connection for the takeover
+func (e *runAllEndpoint) copyClient(conn net.Conn) {
+	defer e.running.Done()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if _, err := e.stdin.Write(buf[:n]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pausing {
+		return
+	}
+	e.conn = nil
+	conn.Close()
+}
+
+// relay sends the wrapper's messages to the connected client; with no client they are dropped
+func (e *runAllEndpoint) relay() {
+	defer e.running.Done()
+	for {
+		chunk, err := e.out.ReadBytes('\n')
+		e.partial = append(e.partial, chunk...)
+		if err != nil {
+			return
+		}
+		line := trimLine(e.partial)
+		e.partial = nil
+		if len(line) == 0 {
+			continue
+		}
+		e.mu.Lock()
+		conn := e.conn
+		e.mu.Unlock()
+		if conn == nil {
+			continue
+		}
+		if err := (&lineWriter{w: conn}).Write(line); err != nil {
+			conn.Close()
+		}
+	}
+}
+
+// copyStderr prefixes the wrapper's stderr with its profile
+func (e *runAllEndpoint) copyStderr() {
+	defer e.running.Done()
+	w := &prefixWriter{prefix: "[" + e.profile + "] ", w: os.Stderr}
+	buf := make([]byte, 4096)
+	for {
+		n, err := e.stderr.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait returns the wrapper's exit code once it ends and stops its listener. The exit
+// code of an adopted wrapper is not known.
+func (e *runAllEndpoint) wait() int {
+	code := 0
+	if e.cmd != nil {
+		err := e.cmd.Wait()
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			code = exitError.ExitCode()
+		} else if err != nil {
+			code = 1
+		}
+	} else {
+		waitProcess(e.process)
+	}
+	e.listener.Close()
+	e.mu.Lock()
+	if e.conn != nil {
+		e.conn.Close()
+	}
+	e.mu.Unlock()
+	if e.cmd == nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: profile %s exited\n", e.profile)
+	} else {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: profile %s exited with code %d\n", e.profile, code)
+	}
+	return code
+}
+
+// pause stops moving the endpoint's data and waits until nothing is in flight; what the
+// wrapper wrote and was not relayed yet stays in out and partial
+func (e *runAllEndpoint) pause() {
+	e.mu.Lock()
+	e.pausing = true
+	conn := e.conn
+	e.mu.Unlock()
+	now := time.Now()
+	if listener, ok := e.listener.(interface{ SetDeadline(time.Time) error }); ok {
+		listener.SetDeadline(now)
+	}
+	if conn != nil {
+		conn.SetReadDeadline(now)
+	}
+	e.stdout.SetReadDeadline(now)
+	e.stderr.SetReadDeadline(now)
+	e.running.Wait()
+}
+
+// resume continues a paused endpoint after a takeover failed
+func (e *runAllEndpoint) resume() {
+	var none time.Time
+	if listener, ok := e.listener.(interface{ SetDeadline(time.Time) error }); ok {
+		listener.SetDeadline(none)
+	}
+	e.stdout.SetReadDeadline(none)
+	e.stderr.SetReadDeadline(none)
+	e.mu.Lock()
+	e.pausing = false
+	if e.conn != nil {
+		e.conn.SetReadDeadline(none)
+	}
+	e.mu.Unlock()
+	e.run()
+}
+
+// pending returns the wrapper output that was read but not relayed yet
+func (e *runAllEndpoint) pending() []byte {
+	buffered, _ := e.out.Peek(e.out.Buffered())
+	return append(bytes.Clone(e.partial), buffered...)
+}
+
+// prefixWriter starts every line written to w with prefix
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+
+	mu      sync.Mutex
+	partial bool
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !p.partial {
+			buf.WriteString(p.prefix)
+		}
+		buf.Write(line)
+		p.partial = line[len(line)-1] != '\n'
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// minTokenLength keeps tokens out of reach of guessing
+	minTokenLength = 16
+	// maxTokenLine bounds the first line a client sends before it is authenticated
+	maxTokenLine = 512
+	// tokenTimeout is how long a client has to authenticate after connecting
+	tokenTimeout = 10 * time.Second
+)
+
+// runAllTokens maps the identity of each client allowed on run-all's TCP endpoints to
+// its token. A client sends its token as the first line of the connection.
+type runAllTokens map[string]string
+
+// loadRunAllTokens reads a JSON object of identities and tokens, such as
+// {"ci-agent": "<token>"}
+func loadRunAllTokens(path string) (runAllTokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := runAllTokens{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON object of identities and tokens: %v", path, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s holds no tokens", path)
+	}
+	for identity, token := range tokens {
+		if len(token) < minTokenLength {
+			return nil, fmt.Errorf("the token of %s is shorter than %d characters", identity, minTokenLength)
+		}
+	}
+	return tokens, nil
+}
+
+// identify returns the identity whose token the client sent, "" if none matches
+func (t runAllTokens) identify(token string) string {
+	for identity, known := range t {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return identity
+		}
+	}
+	return ""
+}
+
+// authenticate reads the token line of a new client and returns the client's identity.
+// The line is read a byte at a time, so that none of the MCP messages after it are
+// consumed here; the connection is handed on as it is.
+func (t runAllTokens) authenticate(conn net.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(tokenTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", fmt.Errorf("no token: %v", err)
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(line) >= maxTokenLine {
+			return "", errors.New("token line too long")
+		}
+		line = append(line, b[0])
+	}
+	identity := t.identify(strings.TrimRight(string(line), "\r"))
+	if identity == "" {
+		return "", errors.New("unknown token")
+	}
+	return identity, nil
+}
+
+// runConnect implements "playwrightwrap connect <endpoint>", bridging the MCP client on
+// stdio to a run-all endpoint and sending the token first
+func runConnect(args []string) int {
+	flags := flag.NewFlagSet("connect", flag.ContinueOnError)
+	tokenFile := flags.String("token-file", "", "file holding the token, PLAYWRIGHTWRAP_TOKEN when empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap connect [--token-file file] tcp://host:port|unix://path")
+		return 2
+	}
+	token := os.Getenv("PLAYWRIGHTWRAP_TOKEN")
+	if *tokenFile != "" {
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read token: %v\n", err)
+			return 1
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	network, address, ok := strings.Cut(flags.Arg(0), "://")
+	if !ok || (network != "tcp" && network != "unix") {
+		fmt.Fprintf(os.Stderr, "Invalid endpoint %q, expected tcp://host:port or unix://path\n", flags.Arg(0))
+		return 2
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to %s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	defer conn.Close()
+	if token != "" {
+		if _, err := fmt.Fprintf(conn, "%s\n", token); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send token: %v\n", err)
+			return 1
+		}
+	}
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+			closer.CloseWrite()
+		}
+	}()
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		fmt.Fprintf(os.Stderr, "Connection to %s failed: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	return 0
+}
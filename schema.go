@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// jsonSchema is the subset of JSON Schema used by MCP tool input schemas
+type jsonSchema struct {
+	Type                 json.RawMessage        `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+}
+
+// ArgumentValidator checks tool call arguments against the input schemas the child
+// advertised in its tools/list response
+type ArgumentValidator struct {
+	mu      sync.Mutex
+	schemas map[string]*jsonSchema
+}
+
+// NewArgumentValidator creates a validator, or returns nil when validation is off
+func NewArgumentValidator(enabled bool) *ArgumentValidator {
+	if !enabled {
+		return nil
+	}
+	return &ArgumentValidator{schemas: make(map[string]*jsonSchema)}
+}
+
+// Learn stores the schemas of a tools/list result. A nil validator ignores them.
+func (v *ArgumentValidator) Learn(result json.RawMessage) {
+	if v == nil {
+		return
+	}
+	var list struct {
+		Tools []struct {
+			Name        string      `json:"name"`
+			InputSchema *jsonSchema `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(result, &list); err != nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, tool := range list.Tools {
+		if tool.InputSchema != nil {
+			v.schemas[tool.Name] = tool.InputSchema
+		}
+	}
+}
+
+// Validate returns why the call's arguments do not match its tool's schema, or "" if
+// they do or the schema is unknown
+func (v *ArgumentValidator) Validate(call *toolCall) string {
+	if v == nil {
+		return ""
+	}
+	v.mu.Lock()
+	schema, ok := v.schemas[call.Name]
+	v.mu.Unlock()
+	if !ok {
+		return ""
+	}
+	// Missing arguments are an empty object, not null
+	if err := schema.validate(map[string]interface{}(call.Arguments), "arguments"); err != nil {
+		return fmt.Sprintf("invalid arguments for %s: %v", call.Name, err)
+	}
+	return ""
+}
+
+// validate checks value, decoded by encoding/json, against the schema
+func (s *jsonSchema) validate(value interface{}, path string) error {
+	if s == nil {
+		return nil
+	}
+	if types := s.types(); len(types) > 0 && !matchesAnyType(value, types) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value))
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		return fmt.Errorf("%s: %v is not one of %v", path, value, s.Enum)
+	}
+	if len(s.AnyOf) > 0 || len(s.OneOf) > 0 {
+		matched := 0
+		for _, alternative := range append(append([]*jsonSchema(nil), s.AnyOf...), s.OneOf...) {
+			if alternative.validate(value, path) == nil {
+				matched++
+			}
+		}
+		if matched == 0 || (len(s.OneOf) > 0 && matched > 1) {
+			return fmt.Errorf("%s: does not match exactly the allowed alternatives", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s.%s: required", path, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				if err := property.validate(v[name], path+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			if string(s.AdditionalProperties) == "false" {
+				return fmt.Errorf("%s.%s: unknown property", path, name)
+			}
+			var additional jsonSchema
+			if json.Unmarshal(s.AdditionalProperties, &additional) == nil {
+				if err := additional.validate(v[name], path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d characters", path, *s.MaxLength)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than %v", path, v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: %v is greater than %v", path, v, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+// types returns the allowed types, given as a string or a list of strings
+func (s *jsonSchema) types() []string {
+	if len(s.Type) == 0 {
+		return nil
+	}
+	var single string
+	if json.Unmarshal(s.Type, &single) == nil {
+		return []string{single}
+	}
+	var list []string
+	json.Unmarshal(s.Type, &list)
+	return list
+}
+
+func matchesAnyType(value interface{}, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON type of a decoded value; whole numbers are integers
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
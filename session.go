@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionsDir       = "sessions"
+	archiveDir        = "archive"
+	sessionStateFile  = "storage_state.json"
+	sessionLogFile    = "session.log"
+	sessionStatusFile = "status.json"
+	sessionSocketFile = "control.sock"
+)
+
+// Session states written to the status file
+const (
+	statusStarting = "starting"
+	statusRunning  = "running"
+	statusExiting  = "exiting"
+)
+
+// sessionStatus is the content of a session's status file
+type sessionStatus struct {
+	ID       string    `json:"id"`
+	PID      int       `json:"pid"`
+	Profile  string    `json:"profile"`
+	State    string    `json:"state"`
+	ChildPID int       `json:"childPid,omitempty"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+	ExitCode *int      `json:"exitCode,omitempty"`
+}
+
+// SessionDir is the directory holding everything one session writes: the storage state
+// copy, the log, the status file and the control socket
+type SessionDir struct {
+	dir string
+
+	mu     sync.Mutex
+	status sessionStatus
+}
+
+// NewSessionDir creates a new directory below the sessions directory
+func NewSessionDir(profile string) (*SessionDir, error) {
+	parent := filepath.Join(sessionTmpDir(), sessionsDir)
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return nil, err
+	}
+	pattern := fmt.Sprintf("%d-*", os.Getpid())
+	if deterministic() {
+		pattern = "session-*"
+	}
+	dir, err := mkdirTemp(parent, pattern)
+	if err != nil {
+		return nil, err
+	}
+	now := clockNow()
+	s := &SessionDir{dir: dir, status: sessionStatus{
+		ID:      filepath.Base(dir),
+		PID:     os.Getpid(),
+		Profile: profile,
+		State:   statusStarting,
+		Started: now,
+	}}
+	return s, s.writeStatus()
+}
+
+// Path returns the location of a file in the session directory
+func (s *SessionDir) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// SetStatus records a state change in the status file
+func (s *SessionDir) SetStatus(state string, update func(status *sessionStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State = state
+	if update != nil {
+		update(&s.status)
+	}
+	s.writeStatus()
+}
+
+// writeStatus replaces the status file atomically; the caller holds the lock or owns s
+func (s *SessionDir) writeStatus() error {
+	s.status.Updated = clockNow()
+	data, err := json.MarshalIndent(s.status, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.Path(sessionStatusFile)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Close removes the session directory, or moves it to the archive when keep is set.
+// The storage state copy is always deleted, since it holds credentials.
+func (s *SessionDir) Close(keep bool) error {
+	os.Remove(s.Path(sessionStateFile))
+	os.Remove(s.Path(sessionSocketFile))
+	if keep {
+		archive := filepath.Join(sessionTmpDir(), archiveDir)
+		if err := os.MkdirAll(archive, 0700); err != nil {
+			return err
+		}
+		return os.Rename(s.dir, filepath.Join(archive, filepath.Base(s.dir)))
+	}
+	// Rename first so the directory disappears at once for anyone listing sessions
+	removing := s.dir + ".removing"
+	if err := os.Rename(s.dir, removing); err != nil {
+		return os.RemoveAll(s.dir)
+	}
+	return os.RemoveAll(removing)
+}
+
+// runningSession is a session found in the sessions directory
+type runningSession struct {
+	dir    string
+	status sessionStatus
+}
+
+// listSessions reads the status of every session directory, oldest first
+func listSessions() []runningSession {
+	paths, _ := filepath.Glob(filepath.Join(sessionTmpDir(), sessionsDir, "*", sessionStatusFile))
+	var sessions []runningSession
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if strings.HasSuffix(dir, ".removing") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var status sessionStatus
+		if json.Unmarshal(data, &status) != nil {
+			continue
+		}
+		sessions = append(sessions, runningSession{dir: dir, status: status})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].status.Started.Before(sessions[j].status.Started) })
+	return sessions
+}
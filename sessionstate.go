@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// buildSessionState reads a profile's storage state and applies the profile's
+// transformations, returning the content for the session's temp copy
+func buildSessionState(path string, profile *ProfileConfig, logger *Logger) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand template placeholders into the copy only, the profile keeps them
+	if profile.Template {
+		var variables []string
+		data, variables, err = expandTemplate(data)
+		if err != nil {
+			return nil, err
+		}
+		logger.Log("Expanded template variables: %v", variables)
+	}
+
+	if profile.PruneExpired {
+		state := &StorageState{}
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("invalid storage state: %v", err)
+		}
+		pruneStorageState(state, time.Now(), logger)
+		if data, err = state.marshal(); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// pruneStorageState drops cookies that have already expired and origins without any storage
+func pruneStorageState(state *StorageState, now time.Time, logger *Logger) {
+	cookies := state.Cookies[:0]
+	for _, cookie := range state.Cookies {
+		if cookie.Expires > 0 && cookie.Expires < float64(now.Unix()) {
+			logger.Log("Pruned expired cookie %s for %s%s (expired %s)", cookie.Name, cookie.Domain, cookie.Path,
+				time.Unix(int64(cookie.Expires), 0).UTC().Format(time.RFC3339))
+			continue
+		}
+		cookies = append(cookies, cookie)
+	}
+	state.Cookies = cookies
+
+	origins := state.Origins[:0]
+	for _, origin := range state.Origins {
+		if len(origin.LocalStorage) == 0 && len(origin.IndexedDB) == 0 {
+			logger.Log("Pruned empty origin %s", origin.Origin)
+			continue
+		}
+		origins = append(origins, origin)
+	}
+	state.Origins = origins
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// mcpClient is an MCP client the wrapper can be registered with
+type mcpClient struct {
+	// path returns the client's config file
+	path func(home string) string
+	// key is the object in the config file holding the servers
+	key string
+	// stdioType is set for clients that want the transport in each entry
+	stdioType bool
+}
+
+var mcpClients = map[string]mcpClient{
+	"vscode": {
+		path:      func(string) string { return filepath.Join(".vscode", "mcp.json") },
+		key:       "servers",
+		stdioType: true,
+	},
+	"cursor": {
+		path: func(home string) string { return filepath.Join(home, ".cursor", "mcp.json") },
+		key:  "mcpServers",
+	},
+	"claude-desktop": {
+		path: func(home string) string {
+			switch runtime.GOOS {
+			case "darwin":
+				return filepath.Join(home, "Library", "Application Support", "Claude", "claude_desktop_config.json")
+			case "windows":
+				return filepath.Join(envOr("APPDATA", filepath.Join(home, "AppData", "Roaming")), "Claude", "claude_desktop_config.json")
+			}
+			return filepath.Join(envOr("XDG_CONFIG_HOME", filepath.Join(home, ".config")), "Claude", "claude_desktop_config.json")
+		},
+		key: "mcpServers",
+	},
+}
+
+// wizard asks questions on the terminal
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask returns the answer to a question, def when it is left empty
+func (w *wizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, _ := w.in.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// confirm asks a yes or no question
+func (w *wizard) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(w.ask(question+" ("+hint+")", ""))
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// runSetup implements "playwrightwrap setup", a guided first run: it checks Node.js,
+// creates a profile, installs the browsers, captures a login and registers the wrapper
+// with an MCP client
+func runSetup(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap setup")
+		return 2
+	}
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	path := configPath()
+	config, err := LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(w.out, "1. Node.js")
+	nodePath, nodeVersion, err := checkNode()
+	if err != nil {
+		fmt.Fprintf(w.out, "   %v\n   Install Node.js and run setup again.\n", err)
+		return 1
+	}
+	fmt.Fprintf(w.out, "   Node.js %s at %s\n", nodeVersion, nodePath)
+	if _, err := exec.LookPath("npx"); err != nil {
+		fmt.Fprintf(w.out, "   npx not found: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(w.out, "\n2. Profile")
+	profile := w.ask("   Profile name", profileName())
+	statePath := w.ask("   Storage state file", config.storageStatePath(profile))
+	if statePath != config.storageStatePath(profile) {
+		if config.Profiles == nil {
+			config.Profiles = make(map[string]*ProfileConfig)
+		}
+		if config.Profiles[profile] == nil {
+			config.Profiles[profile] = &ProfileConfig{}
+		}
+		config.Profiles[profile].StorageState = statePath
+	}
+	if err := config.save(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write config %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(w.out, "   Saved %s\n", path)
+
+	fmt.Fprintln(w.out, "\n3. Browsers")
+	env, _ := config.childEnv(profile)
+	if installed := installedBrowsers(env); len(installed) > 0 {
+		fmt.Fprintf(w.out, "   Installed: %s\n", strings.Join(installed, ", "))
+	}
+	if w.confirm("   Download "+mcpPackage+" and the configured browsers now", len(installedBrowsers(env)) == 0) {
+		if code := runWarm([]string{"--profile", profile}); code != 0 {
+			return code
+		}
+	}
+
+	fmt.Fprintln(w.out, "\n4. Login")
+	if code := setupLogin(w, config, profile, statePath, env); code != 0 {
+		return code
+	}
+
+	fmt.Fprintln(w.out, "\n5. MCP client")
+	names := make([]string, 0, len(mcpClients))
+	for name := range mcpClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	client := w.ask("   Register with ("+strings.Join(names, ", ")+", or none)", "none")
+	if client != "none" {
+		if err := registerClient(client, profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to register with %s: %v\n", client, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(w.out, "\nSetup complete. Sessions of profile %s use %s\n", profile, statePath)
+	return 0
+}
+
+// setupLogin opens a browser for the user to log in and saves its state to the profile.
+// Without a login the profile starts with an empty state.
+func setupLogin(w *wizard, config *Config, profile, statePath string, env []string) int {
+	url := w.ask("   URL to log in to, empty to skip", "")
+	if url == "" {
+		if _, err := os.Stat(statePath); os.IsNotExist(err) {
+			if err := (&StorageState{}).save(statePath); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write storage state %s: %v\n", statePath, err)
+				return 1
+			}
+			fmt.Fprintf(w.out, "   Created an empty storage state, import cookies later with `playwrightwrap import`\n")
+		}
+		return 0
+	}
+	capture, err := createTemp("", "playwrightwrap-login-*.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create capture file: %v\n", err)
+		return 1
+	}
+	capture.Close()
+	defer os.Remove(capture.Name())
+	fmt.Fprintln(w.out, "   Log in in the browser window, then close it")
+	if err := runNpx(env, "--yes", "--package", config.mcpPackageSpec(), "playwright", "open", "--save-storage="+capture.Name(), url); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to capture the login: %v\n", err)
+		return 1
+	}
+	captured, err := loadStorageState(capture.Name())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the captured login: %v\n", err)
+		return 1
+	}
+	state := captured
+	if existing, err := loadStorageState(statePath); err == nil {
+		state = mergeStorageState(existing, captured)
+	}
+	if err := state.save(statePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write storage state %s: %v\n", statePath, err)
+		return 1
+	}
+	fmt.Fprintf(w.out, "   Saved %d cookies to profile %s\n", len(captured.Cookies), profile)
+	return 0
+}
+
+// registerClient adds the wrapper to an MCP client's config, keeping its other entries
+func registerClient(name, profile string) error {
+	client, ok := mcpClients[name]
+	if !ok {
+		return fmt.Errorf("unknown client %q", name)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	path := client.path(home)
+	document := make(map[string]interface{})
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("%s is not valid JSON, not changing it: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	servers, _ := document[client.key].(map[string]interface{})
+	if servers == nil {
+		servers = make(map[string]interface{})
+	}
+	entry := map[string]interface{}{
+		"command": self,
+		"args":    []string{},
+		"env":     map[string]string{"PLAYWRIGHTWRAP_PROFILE": profile},
+	}
+	if client.stdioType {
+		entry["type"] = "stdio"
+	}
+	server := "playwright"
+	if profile != defaultProfileName {
+		server += "-" + profile
+	}
+	servers[server] = entry
+	document[client.key] = servers
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "   Added server %s to %s, restart the client to pick it up\n", server, path)
+	return nil
+}
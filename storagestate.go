@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StorageState is the Playwright storage state file format
+type StorageState struct {
+	Cookies []Cookie      `json:"cookies"`
+	Origins []OriginState `json:"origins"`
+}
+
+// Cookie is a cookie as stored by Playwright. Expires is in Unix seconds, -1 for session cookies.
+type Cookie struct {
+	Name         string  `json:"name"`
+	Value        string  `json:"value"`
+	Domain       string  `json:"domain"`
+	Path         string  `json:"path"`
+	Expires      float64 `json:"expires"`
+	HTTPOnly     bool    `json:"httpOnly"`
+	Secure       bool    `json:"secure"`
+	SameSite     string  `json:"sameSite"`
+	PartitionKey string  `json:"partitionKey,omitempty"`
+}
+
+// OriginState holds the web storage of one origin
+type OriginState struct {
+	Origin       string          `json:"origin"`
+	LocalStorage []NameValue     `json:"localStorage"`
+	IndexedDB    json.RawMessage `json:"indexedDB,omitempty"`
+}
+
+// NameValue is a localStorage entry
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// loadStorageState reads a storage state file
+func loadStorageState(path string) (*StorageState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &StorageState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid storage state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// marshal encodes the storage state, with empty lists instead of nulls as Playwright expects
+func (s *StorageState) marshal() ([]byte, error) {
+	if s.Cookies == nil {
+		s.Cookies = []Cookie{}
+	}
+	if s.Origins == nil {
+		s.Origins = []OriginState{}
+	}
+	for i := range s.Origins {
+		if s.Origins[i].LocalStorage == nil {
+			s.Origins[i].LocalStorage = []NameValue{}
+		}
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// save replaces path with the storage state, readable by the owner only. A failed
+// write leaves the previous file intact.
+func (s *StorageState) save(path string) error {
+	data, err := s.marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// matchesDomain reports whether a cookie domain belongs to one of the given domains.
+// An empty list matches everything.
+func matchesDomain(cookieDomain string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	host := strings.ToLower(strings.TrimPrefix(cookieDomain, "."))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SessionSummary collects what the session did, reported when the wrapper exits
+type SessionSummary struct {
+	Profile      string
+	Downloads    []downloadRecord
+	DirtySignals []string
+	Checkpoints  int
+	LastSaved    time.Time
+	Startup      []phaseTiming
+	// BudgetExceeded is the quota the session ran out of
+	BudgetExceeded string
+	BudgetRejected int
+	ErrorCaptures  []errorCaptureRecord
+	// BytesFromClient and BytesToClient are the proxied traffic, Traffic its share per tool
+	BytesFromClient int64
+	BytesToClient   int64
+	Traffic         []toolTraffic
+}
+
+// Lines renders the non-empty sections of the summary
+func (s *SessionSummary) Lines() []string {
+	var lines []string
+	if len(s.Startup) > 0 {
+		lines = append(lines, "Startup: "+formatPhases(s.Startup))
+	}
+	if s.BytesFromClient > 0 || s.BytesToClient > 0 {
+		lines = append(lines, fmt.Sprintf("Traffic: %s from the client, %s to the client", formatSize(s.BytesFromClient), formatSize(s.BytesToClient)))
+		for _, t := range s.Traffic {
+			lines = append(lines, fmt.Sprintf("  %s: %s in calls, %s in responses", t.Tool, formatSize(t.RequestBytes), formatSize(t.ResponseBytes)))
+		}
+	}
+	if s.BudgetExceeded != "" {
+		lines = append(lines, fmt.Sprintf("Budget exceeded: %s, %d call(s) rejected", s.BudgetExceeded, s.BudgetRejected))
+	}
+	if s.Checkpoints > 0 {
+		lines = append(lines, fmt.Sprintf("State saved to profile %s %d time(s), last at %s", s.Profile, s.Checkpoints, s.LastSaved.Format(time.RFC3339)))
+	}
+	if len(s.DirtySignals) > 0 && s.Checkpoints == 0 {
+		lines = append(lines, fmt.Sprintf("State dirty: credentials of profile %s were probably refreshed during the session:", s.Profile))
+		for _, signal := range s.DirtySignals {
+			lines = append(lines, "  "+signal)
+		}
+		lines = append(lines, "  The refreshed state was not saved, enable checkpoint in the profile config to write it back")
+	}
+	if len(s.ErrorCaptures) > 0 {
+		lines = append(lines, fmt.Sprintf("Error captures (%d):", len(s.ErrorCaptures)))
+		for _, c := range s.ErrorCaptures {
+			lines = append(lines, fmt.Sprintf("  %s: %s", c.Tool, strings.Join(nonEmpty(c.Screenshot, c.Snapshot), ", ")))
+		}
+	}
+	if len(s.Downloads) > 0 {
+		lines = append(lines, fmt.Sprintf("Downloads (%d):", len(s.Downloads)))
+		for _, d := range s.Downloads {
+			status := "kept"
+			if d.Rejected {
+				status = "removed, not allowed"
+			}
+			lines = append(lines, fmt.Sprintf("  %s (%s, %d bytes, %s)", d.Path, d.Type, d.Size, status))
+		}
+	}
+	return lines
+}
+
+func nonEmpty(values ...string) []string {
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// Report writes the summary to the log and to w, if there is anything to report
+func (s *SessionSummary) Report(logger *Logger, w io.Writer) {
+	lines := s.Lines()
+	if len(lines) == 0 {
+		return
+	}
+	for _, line := range lines {
+		logger.Log("Summary: %s", strings.TrimSpace(line))
+	}
+	fmt.Fprintf(w, "playwrightwrap session summary:\n%s\n", strings.Join(lines, "\n"))
+}
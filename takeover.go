@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	takeoverSocketFile = "takeover.sock"
+	takeoverTimeout    = 10 * time.Second
+	// maxTakeoverHeader bounds the header a run-all accepts from the one it takes over
+	maxTakeoverHeader = 64 << 20
+)
+
+// takeoverHeader describes the endpoints a run-all hands over; the files of each
+// endpoint follow in separate messages, in the same order
+type takeoverHeader struct {
+	// SocketDirs are removed by whoever ends the sessions
+	SocketDirs []string           `json:"socketDirs"`
+	Endpoints  []takeoverEndpoint `json:"endpoints"`
+}
+
+type takeoverEndpoint struct {
+	Profile  string `json:"profile"`
+	Endpoint string `json:"endpoint"`
+	PID      int    `json:"pid"`
+	// Pending is wrapper output that was read but not relayed to the client yet
+	Pending []byte `json:"pending,omitempty"`
+	// Client is set when a client connection is handed over with the endpoint
+	Client bool `json:"client,omitempty"`
+	// Tokens keep admitting the clients the endpoint admitted
+	Tokens runAllTokens `json:"tokens,omitempty"`
+}
+
+// runAllDir is the socket directory of the run-all with the given PID
+func runAllDir(pid int) string {
+	return filepath.Join(sessionTmpDir(), fmt.Sprintf("run-all-%d", pid))
+}
+
+// serveTakeover hands the endpoints to the first run-all that connects and takes them,
+// then closes handedOff. After a failed attempt the endpoints carry on here.
+func serveTakeover(listener net.Listener, endpoints []*runAllEndpoint, socketDirs []string, handedOff chan struct{}) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		err = handOver(conn.(*net.UnixConn), endpoints, socketDirs)
+		conn.Close()
+		if err == nil {
+			close(handedOff)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "playwrightwrap: takeover failed, keeping the sessions: %v\n", err)
+	}
+}
+
+// handOver pauses the endpoints and sends their listeners, wrapper pipes and clients,
+// waiting for the new run-all to acknowledge them
+func handOver(conn *net.UnixConn, endpoints []*runAllEndpoint, socketDirs []string) error {
+	conn.SetDeadline(time.Now().Add(takeoverTimeout))
+	for _, e := range endpoints {
+		e.pause()
+	}
+	var dups []*os.File
+	defer func() { closeFiles(dups...) }()
+	err := func() error {
+		header := takeoverHeader{SocketDirs: socketDirs}
+		var files [][]*os.File
+		for _, e := range endpoints {
+			listener, err := e.listener.(interface{ File() (*os.File, error) }).File()
+			if err != nil {
+				return fmt.Errorf("profile %s: %v", e.profile, err)
+			}
+			dups = append(dups, listener)
+			endpointFiles := []*os.File{listener, e.stdin, e.stdout, e.stderr}
+			if e.conn != nil {
+				client, err := e.conn.(interface{ File() (*os.File, error) }).File()
+				if err != nil {
+					return fmt.Errorf("profile %s: %v", e.profile, err)
+				}
+				dups = append(dups, client)
+				endpointFiles = append(endpointFiles, client)
+			}
+			files = append(files, endpointFiles)
+			header.Endpoints = append(header.Endpoints, takeoverEndpoint{
+				Profile:  e.profile,
+				Endpoint: e.endpoint,
+				PID:      e.process.Pid,
+				Pending:  e.pending(),
+				Client:   e.conn != nil,
+				Tokens:   e.tokens,
+			})
+		}
+		data, err := json.Marshal(header)
+		if err != nil {
+			return err
+		}
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+		if _, err := conn.Write(append(size[:], data...)); err != nil {
+			return err
+		}
+		for _, endpointFiles := range files {
+			if err := sendFiles(conn, endpointFiles); err != nil {
+				return err
+			}
+		}
+		ack := make([]byte, 1)
+		if _, err := io.ReadFull(conn, ack); err != nil {
+			return fmt.Errorf("the new run-all did not acknowledge: %v", err)
+		}
+		return nil
+	}()
+	if err != nil {
+		for _, e := range endpoints {
+			e.resume()
+		}
+	}
+	return err
+}
+
+// adoptRunAll takes the endpoints over from the run-all with the given PID and returns
+// them with the socket directories to clean up
+func adoptRunAll(pid int) ([]*runAllEndpoint, []string, error) {
+	if !takeoverSupported {
+		return nil, nil, errors.New("takeover passes file descriptors, which is only supported on Unix")
+	}
+	conn, err := net.DialTimeout("unix", filepath.Join(runAllDir(pid), takeoverSocketFile), takeoverTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(takeoverTimeout))
+	unixConn := conn.(*net.UnixConn)
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, nil, err
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length > maxTakeoverHeader {
+		return nil, nil, fmt.Errorf("takeover header of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, nil, err
+	}
+	var header takeoverHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, nil, fmt.Errorf("invalid takeover header: %v", err)
+	}
+
+	var endpoints []*runAllEndpoint
+	fail := func(err error) ([]*runAllEndpoint, []string, error) {
+		for _, e := range endpoints {
+			e.listener.Close()
+			closeFiles(e.stdin, e.stdout, e.stderr)
+			if e.conn != nil {
+				e.conn.Close()
+			}
+		}
+		return nil, nil, err
+	}
+	for _, adopted := range header.Endpoints {
+		count := 4
+		if adopted.Client {
+			count = 5
+		}
+		files, err := receiveFiles(unixConn, count)
+		if err != nil {
+			return fail(fmt.Errorf("profile %s: %v", adopted.Profile, err))
+		}
+		e := &runAllEndpoint{profile: adopted.Profile, endpoint: adopted.Endpoint, tokens: adopted.Tokens, stdin: files[1], stdout: files[2], stderr: files[3]}
+		e.listener, err = net.FileListener(files[0])
+		files[0].Close()
+		if err == nil && adopted.Client {
+			e.conn, err = net.FileConn(files[4])
+			files[4].Close()
+		}
+		if err == nil {
+			e.process, err = os.FindProcess(adopted.PID)
+		}
+		if err != nil {
+			if e.listener != nil {
+				e.listener.Close()
+			}
+			closeFiles(files[1:4]...)
+			return fail(fmt.Errorf("profile %s: %v", adopted.Profile, err))
+		}
+		e.out = bufio.NewReaderSize(io.MultiReader(bytes.NewReader(adopted.Pending), e.stdout), 64*1024)
+		endpoints = append(endpoints, e)
+	}
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return fail(err)
+	}
+	return endpoints, header.SocketDirs, nil
+}
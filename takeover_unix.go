@@ -0,0 +1,69 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+const takeoverSupported = true
+
+// sendFiles passes files to the other end of conn in one message
+func sendFiles(conn *net.UnixConn, files []*os.File) error {
+	fds := make([]int, len(files))
+	for i, f := range files {
+		// Fd would switch the file to blocking mode, which the receiver shares
+		raw, err := f.SyscallConn()
+		if err != nil {
+			return err
+		}
+		if err := raw.Control(func(fd uintptr) { fds[i] = int(fd) }); err != nil {
+			return err
+		}
+	}
+	_, _, err := conn.WriteMsgUnix([]byte{0}, syscall.UnixRights(fds...), nil)
+	return err
+}
+
+// receiveFiles reads a message of sendFiles carrying count files
+func receiveFiles(conn *net.UnixConn, count int) ([]*os.File, error) {
+	oob := make([]byte, syscall.CmsgSpace(count*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(make([]byte, 1), oob)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for i := range messages {
+		rights, err := syscall.ParseUnixRights(&messages[i])
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, rights...)
+	}
+	if len(fds) != count {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		return nil, fmt.Errorf("expected %d file descriptors, got %d", count, len(fds))
+	}
+	files := make([]*os.File, count)
+	for i, fd := range fds {
+		files[i] = os.NewFile(uintptr(fd), "takeover")
+	}
+	return files, nil
+}
+
+// waitProcess waits for a process that is not our child to end
+func waitProcess(process *os.Process) {
+	for process.Signal(syscall.Signal(0)) == nil {
+		time.Sleep(500 * time.Millisecond)
+	}
+}
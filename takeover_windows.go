@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Windows has no file descriptor passing over unix sockets
+const takeoverSupported = false
+
+func sendFiles(conn *net.UnixConn, files []*os.File) error {
+	return errors.New("file descriptor passing is not supported on Windows")
+}
+
+func receiveFiles(conn *net.UnixConn, count int) ([]*os.File, error) {
+	return nil, errors.New("file descriptor passing is not supported on Windows")
+}
+
+func waitProcess(process *os.Process) {
+	process.Wait()
+}
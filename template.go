@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+var templatePlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandTemplate replaces ${ENV_VAR} placeholders in the string values of a storage
+// state document. Values are substituted after parsing, so they cannot break the JSON.
+// Every referenced variable must be set.
+func expandTemplate(data []byte) ([]byte, []string, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("invalid storage state template: %v", err)
+	}
+
+	used := make(map[string]bool)
+	missing := make(map[string]bool)
+	var expand func(value interface{}) interface{}
+	expand = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return templatePlaceholder.ReplaceAllStringFunc(v, func(match string) string {
+				name := templatePlaceholder.FindStringSubmatch(match)[1]
+				substitute, ok := os.LookupEnv(name)
+				if !ok {
+					missing[name] = true
+					return match
+				}
+				used[name] = true
+				return substitute
+			})
+		case []interface{}:
+			for i := range v {
+				v[i] = expand(v[i])
+			}
+		case map[string]interface{}:
+			for key := range v {
+				v[key] = expand(v[key])
+			}
+		}
+		return value
+	}
+	document = expand(document)
+
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("storage state template references unset environment variables: %v", sortedKeys(missing))
+	}
+	expanded, err := json.Marshal(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	return expanded, sortedKeys(used), nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
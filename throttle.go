@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttle enforces a minimum interval between navigations to the same host
+type Throttle struct {
+	mu       sync.Mutex
+	config   *ThrottleConfig
+	lastSeen map[string]time.Time
+}
+
+// NewThrottle creates a throttle, or returns nil when no pacing is configured
+func NewThrottle(config *ThrottleConfig) *Throttle {
+	if config == nil || (config.Interval <= 0 && len(config.Hosts) == 0) {
+		return nil
+	}
+	return &Throttle{config: config, lastSeen: make(map[string]time.Time)}
+}
+
+// Reserve books the next slot for a navigation to rawURL and returns how long the
+// navigation must wait for it. A nil throttle never delays.
+func (t *Throttle) Reserve(rawURL string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return 0
+	}
+	host := strings.ToLower(parsed.Hostname())
+	interval, _ := t.interval(host)
+	if interval <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	next := t.lastSeen[host].Add(interval)
+	delay := next.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	t.lastSeen[host] = now.Add(delay)
+	t.mu.Unlock()
+	return delay
+}
+
+// interval returns the pacing for host, using the most specific matching Hosts entry.
+// It also returns that entry, "" when the default interval applies.
+func (t *Throttle) interval(host string) (time.Duration, string) {
+	best := ""
+	interval := time.Duration(t.config.Interval)
+	for domain, hostInterval := range t.config.Hosts {
+		domain = strings.ToLower(domain)
+		if (host == domain || strings.HasSuffix(host, "."+domain)) && len(domain) > len(best) {
+			best = domain
+			interval = time.Duration(hostInterval)
+		}
+	}
+	return interval, best
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Startup phases measured by the wrapper. npx resolves the package in the child, which
+// the handshake includes.
+const (
+	phaseSourceFetch   = "source fetch"
+	phaseCopy          = "copy"
+	phaseSetup         = "session setup"
+	phaseNodeCheck     = "node check"
+	phaseProbe         = "probe"
+	phaseChildSpawn    = "child spawn"
+	phaseHandshake     = "mcp handshake"
+	phaseFirstToolCall = "first tool call"
+)
+
+// phaseTiming is the duration of one startup phase
+type phaseTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// StartupTimer measures the phases of a session's cold start
+type StartupTimer struct {
+	logger *Logger
+
+	mu     sync.Mutex
+	start  time.Time
+	last   time.Time
+	phases []phaseTiming
+	seen   map[string]bool
+}
+
+// NewStartupTimer starts timing at the current instant
+func NewStartupTimer(logger *Logger) *StartupTimer {
+	now := clockNow()
+	return &StartupTimer{logger: logger, start: now, last: now, seen: make(map[string]bool)}
+}
+
+// Mark ends a sequential phase that started when the previous one ended
+func (t *StartupTimer) Mark(name string) {
+	t.mu.Lock()
+	now := clockNow()
+	d := now.Sub(t.last)
+	t.last = now
+	t.mu.Unlock()
+	t.Record(name, d)
+}
+
+// Record stores the duration of a phase measured elsewhere. Only the first
+// measurement of each phase counts. A nil timer records nothing.
+func (t *StartupTimer) Record(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen[name] {
+		return
+	}
+	t.seen[name] = true
+	t.phases = append(t.phases, phaseTiming{Name: name, Duration: d})
+	t.logger.Log("Startup phase %s took %v (%v since start)", name, d, clockSince(t.start))
+}
+
+// Phases returns the phases measured so far
+func (t *StartupTimer) Phases() []phaseTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]phaseTiming(nil), t.phases...)
+}
+
+// Elapsed returns the time since the timer started
+func (t *StartupTimer) Elapsed() time.Duration {
+	return clockSince(t.start)
+}
+
+// formatPhases renders phases on one line, such as "copy 1ms, child spawn 3ms"
+func formatPhases(phases []phaseTiming) string {
+	parts := make([]string, 0, len(phases))
+	for _, phase := range phases {
+		parts = append(parts, fmt.Sprintf("%s %v", phase.Name, phase.Duration.Round(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
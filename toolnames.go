@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ToolNamer renames the child's tools as the client sees them, so hosts that aggregate
+// several browser servers do not get colliding names
+type ToolNamer struct {
+	prefix string
+	// renames maps child names to client names, reverse the other way around
+	renames map[string]string
+	reverse map[string]string
+}
+
+// NewToolNamer creates a namer, or returns nil when tools keep their names
+func NewToolNamer(prefix string, renames map[string]string) (*ToolNamer, error) {
+	if prefix == "" && len(renames) == 0 {
+		return nil, nil
+	}
+	n := &ToolNamer{prefix: prefix, renames: renames, reverse: make(map[string]string)}
+	for original, exposed := range renames {
+		if exposed == "" {
+			return nil, fmt.Errorf("empty new name for tool %s", original)
+		}
+		if other, ok := n.reverse[exposed]; ok {
+			return nil, fmt.Errorf("tools %s and %s are both renamed to %s", other, original, exposed)
+		}
+		n.reverse[exposed] = original
+	}
+	return n, nil
+}
+
+// exposed returns the name the client sees for a child tool. Renamed tools get no prefix.
+func (n *ToolNamer) exposed(name string) string {
+	if renamed, ok := n.renames[name]; ok {
+		return renamed
+	}
+	return n.prefix + name
+}
+
+// original returns the child's name for a tool the client called
+func (n *ToolNamer) original(name string) string {
+	if original, ok := n.reverse[name]; ok {
+		return original
+	}
+	return strings.TrimPrefix(name, n.prefix)
+}
+
+// rewriteCall renames the tool of a client's tools/call request for the child
+func (n *ToolNamer) rewriteCall(msg *rpcMessage, call *toolCall) ([]byte, error) {
+	original := n.original(call.Name)
+	if original == call.Name {
+		return nil, nil
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, err
+	}
+	name, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	params["name"] = name
+	if msg.Params, err = json.Marshal(params); err != nil {
+		return nil, err
+	}
+	call.Name = original
+	return json.Marshal(msg)
+}
+
+// rewriteList renames the tools of the child's tools/list response for the client
+func (n *ToolNamer) rewriteList(msg *rpcMessage) ([]byte, error) {
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		return nil, err
+	}
+	var tools []map[string]json.RawMessage
+	if err := json.Unmarshal(result["tools"], &tools); err != nil {
+		return nil, err
+	}
+	for _, tool := range tools {
+		var name string
+		if err := json.Unmarshal(tool["name"], &name); err != nil {
+			return nil, err
+		}
+		exposed, err := json.Marshal(n.exposed(name))
+		if err != nil {
+			return nil, err
+		}
+		tool["name"] = exposed
+	}
+	var err error
+	if result["tools"], err = json.Marshal(tools); err != nil {
+		return nil, err
+	}
+	if msg.Result, err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultRatePeriod = time.Minute
+
+// ToolConfig overrides the profile's settings for the tools its key matches
+type ToolConfig struct {
+	// Timeout answers a call with an error when the child takes longer; the call is
+	// cancelled in the child and its late response dropped
+	Timeout Duration `json:"timeout,omitempty"`
+	// MaxResponseSize replaces results larger than this many bytes with an error
+	MaxResponseSize int `json:"maxResponseSize,omitempty"`
+	// RateLimit caps how often the tool may be called
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+	// Allow set to false blocks the tool; true unblocks it where a less specific entry
+	// blocks it. The profile's policy still applies, use its allowTools to exempt a tool.
+	Allow *bool `json:"allow,omitempty"`
+	// Redaction adds redaction sets to the ones of the profile for the tool's responses
+	Redaction []string `json:"redaction,omitempty"`
+}
+
+// RateLimitConfig allows Calls calls in any Per period, one minute by default
+type RateLimitConfig struct {
+	Calls int      `json:"calls"`
+	Per   Duration `json:"per,omitempty"`
+}
+
+// toolSettings are the overrides in force for one tool
+type toolSettings struct {
+	timeout         time.Duration
+	maxResponseSize int
+	rate            *rateLimiter
+	allow           *bool
+	redactor        *Redactor
+}
+
+// toolOverride is one compiled entry of the tools map
+type toolOverride struct {
+	pattern  string
+	config   *ToolConfig
+	rate     *rateLimiter
+	redactor *Redactor
+}
+
+// ToolOverrides resolves the settings of a tool from the entries matching its name
+type ToolOverrides struct {
+	// overrides are sorted from the most to the least specific pattern
+	overrides []*toolOverride
+
+	mu       sync.Mutex
+	resolved map[string]*toolSettings
+}
+
+// NewToolOverrides compiles the tools map of a profile, keyed by the child's tool names or
+// patterns such as "browser_tab_*". It returns nil when the map is empty.
+func NewToolOverrides(config *Config, tools map[string]*ToolConfig) (*ToolOverrides, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	o := &ToolOverrides{resolved: make(map[string]*toolSettings)}
+	for pattern, tool := range tools {
+		if tool == nil {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern %q: %v", pattern, err)
+		}
+		override := &toolOverride{pattern: pattern, config: tool}
+		if tool.RateLimit != nil {
+			if tool.RateLimit.Calls <= 0 {
+				return nil, fmt.Errorf("rate limit of tools %q needs a positive number of calls", pattern)
+			}
+			override.rate = newRateLimiter(tool.RateLimit)
+		}
+		redactor, err := NewRedactor(config, tool.Redaction)
+		if err != nil {
+			return nil, fmt.Errorf("tools %q: %v", pattern, err)
+		}
+		override.redactor = redactor
+		o.overrides = append(o.overrides, override)
+	}
+	// An exact name is more specific than any pattern, a longer pattern than a shorter one
+	sort.Slice(o.overrides, func(i, j int) bool {
+		a, b := o.overrides[i].pattern, o.overrides[j].pattern
+		if exactA, exactB := !hasWildcard(a), !hasWildcard(b); exactA != exactB {
+			return exactA
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	return o, nil
+}
+
+func hasWildcard(pattern string) bool {
+	for _, c := range pattern {
+		if c == '*' || c == '?' || c == '[' || c == '\\' {
+			return true
+		}
+	}
+	return false
+}
+
+// settings returns the overrides for a tool, each setting from the most specific entry
+// that sets it. A nil ToolOverrides overrides nothing.
+func (o *ToolOverrides) settings(name string) *toolSettings {
+	if o == nil {
+		return &toolSettings{}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if settings, ok := o.resolved[name]; ok {
+		return settings
+	}
+	settings := &toolSettings{}
+	for _, override := range o.overrides {
+		if ok, _ := path.Match(override.pattern, name); !ok {
+			continue
+		}
+		tool := override.config
+		if settings.timeout == 0 {
+			settings.timeout = time.Duration(tool.Timeout)
+		}
+		if settings.maxResponseSize == 0 {
+			settings.maxResponseSize = tool.MaxResponseSize
+		}
+		if settings.rate == nil {
+			settings.rate = override.rate
+		}
+		if settings.allow == nil {
+			settings.allow = tool.Allow
+		}
+		if settings.redactor == nil {
+			settings.redactor = override.redactor
+		}
+	}
+	o.resolved[name] = settings
+	return settings
+}
+
+// Check returns why a call is blocked by the tools map, or "" if it is not. The call is
+// not counted against the rate limit until Count.
+func (s *toolSettings) Check(call *toolCall) string {
+	if s.allow != nil && !*s.allow {
+		return fmt.Sprintf("%s is blocked by the tools config of this session", call.Name)
+	}
+	if s.rate != nil && !s.rate.Available(time.Now()) {
+		return fmt.Sprintf("%s is rate limited to %s, try again later", call.Name, s.rate)
+	}
+	return ""
+}
+
+// Count counts a call that passed screening against the rate limit
+func (s *toolSettings) Count() {
+	if s.rate != nil {
+		s.rate.Take(time.Now())
+	}
+}
+
+// rateLimiter allows a number of calls in a sliding period. Entries matching several
+// tools share it.
+type rateLimiter struct {
+	calls int
+	per   time.Duration
+
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func newRateLimiter(config *RateLimitConfig) *rateLimiter {
+	per := time.Duration(config.Per)
+	if per <= 0 {
+		per = defaultRatePeriod
+	}
+	return &rateLimiter{calls: config.Calls, per: per}
+}
+
+// Available reports whether a call at now would be within the limit
+func (r *rateLimiter) Available(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.times[:0]
+	for _, t := range r.times {
+		if now.Sub(t) < r.per {
+			kept = append(kept, t)
+		}
+	}
+	r.times = kept
+	return len(r.times) < r.calls
+}
+
+// Take counts a call at now
+func (r *rateLimiter) Take(now time.Time) {
+	r.mu.Lock()
+	r.times = append(r.times, now)
+	r.mu.Unlock()
+}
+
+func (r *rateLimiter) String() string {
+	return fmt.Sprintf("%d calls per %v", r.calls, r.per)
+}
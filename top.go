@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultTopInterval = time.Second
+	topStatsTimeout    = 2 * time.Second
+)
+
+// pageURLPattern finds the page URL in the snapshot playwright adds to tool results
+var pageURLPattern = regexp.MustCompile(`(?m)^- Page URL: (\S+)`)
+
+// pageURL returns the page URL a tool result reports, if any
+func pageURL(text string) string {
+	if match := pageURLPattern.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// sessionStats answers the stats control command
+type sessionStats struct {
+	ToolCalls      int64  `json:"toolCalls"`
+	ToolErrors     int64  `json:"toolErrors"`
+	ToolRejections int64  `json:"toolRejections"`
+	Navigations    int64  `json:"navigations"`
+	PageURL        string `json:"pageUrl,omitempty"`
+	// BytesIn and BytesOut are the bytes received from and sent to the client
+	BytesIn  int64         `json:"bytesIn"`
+	BytesOut int64         `json:"bytesOut"`
+	Traffic  []toolTraffic `json:"traffic,omitempty"`
+}
+
+// sessionStats returns the counters of the proxy
+func (p *Proxy) sessionStats() *sessionStats {
+	stats := &sessionStats{
+		ToolCalls:      p.stats.toolCalls.Load(),
+		ToolErrors:     p.stats.toolErrors.Load(),
+		ToolRejections: p.stats.toolRejections.Load(),
+		Navigations:    p.stats.navigations.Load(),
+		BytesIn:        p.stats.bytesFromClient.Load(),
+		BytesOut:       p.stats.bytesToClient.Load(),
+		Traffic:        p.stats.toolTraffic(),
+	}
+	if url := p.stats.pageURL.Load(); url != nil {
+		stats.PageURL = *url
+	}
+	return stats
+}
+
+// registerSessionCommands adds the stats, save and stop commands used by top. saver is
+// nil when the profile's state cannot be written back.
+func registerSessionCommands(control *ControlServer, proxy *Proxy, saver *Checkpointer, stop func()) {
+	control.Handle("stats", func(request *controlRequest) (interface{}, error) {
+		return proxy.sessionStats(), nil
+	})
+	control.Handle("save", func(request *controlRequest) (interface{}, error) {
+		if saver == nil {
+			return nil, errors.New("the state of template profiles cannot be saved")
+		}
+		return nil, saver.Save("control request")
+	})
+	control.Handle("stop", func(request *controlRequest) (interface{}, error) {
+		stop()
+		return nil, nil
+	})
+}
+
+// topRow is one session shown by top
+type topRow struct {
+	session runningSession
+	stats   *sessionStats
+	// rate is tool calls per minute since the previous refresh
+	rate float64
+	// memory is the resident size of the child and its descendants, -1 when unknown
+	memory int64
+	err    error
+}
+
+// topSample remembers a session's call count to compute rates
+type topSample struct {
+	calls int64
+	time  time.Time
+}
+
+// runTop implements "playwrightwrap top", a live view of the running sessions
+func runTop(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	interval := flags.Duration("interval", defaultTopInterval, "refresh interval")
+	once := flags.Bool("once", false, "print the sessions once and exit")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	samples := make(map[string]topSample)
+	info, err := os.Stdin.Stat()
+	if *once || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		renderTop(os.Stdout, collectTop(samples), -1, "")
+		return 0
+	}
+
+	restore := rawTerminal()
+	fmt.Print("\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\n")
+		restore()
+	}()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	keys := make(chan byte)
+	go readKeys(os.Stdin, keys)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	selected := 0
+	message := ""
+	rows := collectTop(samples)
+	for {
+		if selected >= len(rows) {
+			selected = len(rows) - 1
+		}
+		if selected < 0 && len(rows) > 0 {
+			selected = 0
+		}
+		fmt.Print("\x1b[H\x1b[2J")
+		renderTop(os.Stdout, rows, selected, message)
+		select {
+		case <-sigChan:
+			return 0
+		case <-ticker.C:
+			rows = collectTop(samples)
+		case key, ok := <-keys:
+			if !ok || key == 'q' {
+				return 0
+			}
+			switch key {
+			case 'j':
+				selected++
+			case 'k':
+				if selected > 0 {
+					selected--
+				}
+			case 's', 'x':
+				if selected < 0 || selected >= len(rows) {
+					continue
+				}
+				command, done := "save", "Saved the state of %s"
+				if key == 'x' {
+					command, done = "stop", "Asked %s to stop"
+				}
+				id := rows[selected].session.status.ID
+				socket := filepath.Join(rows[selected].session.dir, sessionSocketFile)
+				if _, err := controlCall(socket, &controlRequest{Command: command}); err != nil {
+					message = fmt.Sprintf("Failed to %s %s: %v", command, id, err)
+				} else {
+					message = fmt.Sprintf(done, id)
+				}
+				rows = collectTop(samples)
+			}
+		}
+	}
+}
+
+// collectTop asks every running session for its stats
+func collectTop(samples map[string]topSample) []topRow {
+	now := time.Now()
+	var rows []topRow
+	for _, session := range listSessions() {
+		row := topRow{session: session, memory: -1}
+		socket := filepath.Join(session.dir, sessionSocketFile)
+		result, err := controlCallTimeout(socket, &controlRequest{Command: "stats"}, topStatsTimeout)
+		if err == nil {
+			row.stats = &sessionStats{}
+			err = json.Unmarshal(result, row.stats)
+		}
+		if err != nil {
+			row.err = err
+			row.stats = nil
+		} else {
+			last, ok := samples[session.status.ID]
+			if !ok {
+				last = topSample{time: session.status.Started}
+			}
+			if elapsed := now.Sub(last.time).Minutes(); elapsed > 0 {
+				row.rate = float64(row.stats.ToolCalls-last.calls) / elapsed
+			}
+			samples[session.status.ID] = topSample{calls: row.stats.ToolCalls, time: now}
+		}
+		if session.status.ChildPID > 0 {
+			if memory, err := processMemory(session.status.ChildPID); err == nil {
+				row.memory = memory
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// renderTop draws the session table; selected is -1 when there is no selection
+func renderTop(w io.Writer, rows []topRow, selected int, message string) {
+	fmt.Fprintf(w, "playwrightwrap top - %d session(s) - %s\n", len(rows), time.Now().Format("15:04:05"))
+	if selected >= 0 {
+		fmt.Fprint(w, "j/k select  s save state  x stop  q quit\n")
+	}
+	fmt.Fprintf(w, "\n  %-18s %-12s %-9s %7s %9s %6s %9s  %s\n", "SESSION", "PROFILE", "STATE", "CALLS", "CALLS/MIN", "ERRORS", "MEMORY", "URL")
+	for i, row := range rows {
+		marker := " "
+		if i == selected {
+			marker = ">"
+		}
+		status := row.session.status
+		calls, rate, errs, url := "-", "-", "-", ""
+		if row.stats != nil {
+			calls = strconv.FormatInt(row.stats.ToolCalls, 10)
+			rate = strconv.FormatFloat(row.rate, 'f', 1, 64)
+			errs = strconv.FormatInt(row.stats.ToolErrors+row.stats.ToolRejections, 10)
+			url = row.stats.PageURL
+		} else if row.err != nil {
+			url = "unreachable: " + row.err.Error()
+		}
+		memory := "-"
+		if row.memory >= 0 {
+			memory = fmt.Sprintf("%.1fM", float64(row.memory)/(1<<20))
+		}
+		fmt.Fprintf(w, "%s %-18s %-12s %-9s %7s %9s %6s %9s  %s\n", marker, status.ID, status.Profile, status.State, calls, rate, errs, memory, url)
+	}
+	if message != "" {
+		fmt.Fprintf(w, "\n%s\n", message)
+	}
+}
+
+// readKeys sends the keys typed on r, mapping the up and down arrows to k and j
+func readKeys(r io.Reader, keys chan<- byte) {
+	defer close(keys)
+	reader := bufio.NewReader(r)
+	for {
+		key, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if key == 0x1b {
+			if next, _ := reader.ReadByte(); next != '[' {
+				continue
+			}
+			switch arrow, _ := reader.ReadByte(); arrow {
+			case 'A':
+				key = 'k'
+			case 'B':
+				key = 'j'
+			default:
+				continue
+			}
+		}
+		keys <- key
+	}
+}
+
+// rawTerminal makes single key presses readable without Enter and returns a function
+// restoring the previous mode. Where stty is not available keys need Enter.
+func rawTerminal() func() {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		output, err := cmd.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return func() {}
+	}
+	return func() { stty(saved) }
+}
+
+// processMemory returns the resident memory of a process and its descendants in bytes.
+// Only Linux sees descendants; elsewhere ps reports the process itself.
+func processMemory(pid int) (int64, error) {
+	if runtime.GOOS != "linux" {
+		output, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+		if err != nil {
+			return 0, err
+		}
+		kib, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+		return kib * 1024, err
+	}
+	children := make(map[int][]int)
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces, the fields after it are fixed
+		end := strings.LastIndexByte(string(data), ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(string(data[end+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		child, _ := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		parent, _ := strconv.Atoi(fields[1])
+		children[parent] = append(children[parent], child)
+	}
+	var total int64
+	found := false
+	queue := []int{pid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = append(queue[1:], children[current]...)
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", current))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			continue
+		}
+		pages, _ := strconv.ParseInt(fields[1], 10, 64)
+		total += pages * int64(os.Getpagesize())
+		found = true
+	}
+	if !found {
+		return 0, fmt.Errorf("process %d not found", pid)
+	}
+	return total, nil
+}
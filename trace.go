@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runTrace implements "playwrightwrap trace <subcommand>"
+func runTrace(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: playwrightwrap trace open [flags] [trace.zip]")
+		return 2
+	}
+	switch args[0] {
+	case "open":
+		return runTraceOpen(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown trace subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runTraceOpen opens the given trace, or the newest one in the output directory, in the
+// Playwright trace viewer
+func runTraceOpen(args []string) int {
+	flags := flag.NewFlagSet("trace open", flag.ContinueOnError)
+	profile := flags.String("profile", profileName(), "profile whose output directory is searched")
+	dir := flags.String("dir", "", "directory to search instead of the profile's output directory")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	trace := flags.Arg(0)
+	if trace == "" {
+		searchDir := *dir
+		if searchDir == "" {
+			if searchDir, err = config.outputDir(*profile); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to find a trace: %v; pass --dir or the trace zip\n", err)
+				return 1
+			}
+		}
+		if trace, err = newestTrace(searchDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to find a trace: %v\n", err)
+			return 1
+		}
+	}
+
+	env, _ := config.childEnv(*profile)
+	fmt.Fprintf(os.Stderr, "Opening %s\n", trace)
+	if err := runNpx(env, "--yes", "--package", config.mcpPackageSpec(), "playwright", "show-trace", trace); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open trace viewer: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// outputDir returns the directory the named profile's sessions write their output to.
+// That is the --output-dir of the profile's latest session with a manifest, or the
+// managed downloads directory when it is absolute and no such session is left.
+func (c *Config) outputDir(name string) (string, error) {
+	manifests, _ := filepath.Glob(filepath.Join(sessionTmpDir(), sessionsDir, "*", sessionManifestFile))
+	archived, _ := filepath.Glob(filepath.Join(sessionTmpDir(), archiveDir, "*", sessionManifestFile))
+	var latest *sessionManifest
+	for _, path := range append(manifests, archived...) {
+		manifest, err := loadManifest(path)
+		if err != nil || manifest.Profile != name {
+			continue
+		}
+		if latest == nil || manifest.Created.After(latest.Created) {
+			latest = manifest
+		}
+	}
+	if latest != nil {
+		dir := flagValue(latest.ChildArgs, "--output-dir")
+		if dir == "" {
+			return "", fmt.Errorf("the last session of profile %s ran without --output-dir, so the child wrote to a temporary directory", name)
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(latest.WorkDir, dir)
+		}
+		return dir, nil
+	}
+	if downloads := c.Profile(name).Downloads; downloads != nil && filepath.IsAbs(downloads.Dir) {
+		return downloads.Dir, nil
+	}
+	return "", fmt.Errorf("no session of profile %s recorded its output directory", name)
+}
+
+// newestTrace returns the most recently modified trace zip below dir
+func newestTrace(dir string) (string, error) {
+	var newest string
+	var newestTime time.Time
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".zip") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(newestTime) {
+			newest, newestTime = path, info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if newest == "" {
+		return "", errors.New("no trace zip in " + dir + ", start the session with --save-trace")
+	}
+	return newest, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// transcriptTextLimit keeps results short enough to paste into a ticket
+const transcriptTextLimit = 600
+
+// writeTranscript renders the report as Markdown. Screenshots are written to imageDir
+// and linked relative to the transcript, which is written to dir.
+func writeTranscript(w io.Writer, data *reportData, dir, imageDir string) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# Session transcript\n\n")
+	fmt.Fprintf(out, "Recording `%s`", data.Source)
+	if data.Started != "" {
+		fmt.Fprintf(out, ", started %s, lasted %s", data.Started, data.Duration)
+	}
+	fmt.Fprintf(out, ". %d tool call(s), %d error(s), %d navigation(s).\n", len(data.Calls), data.Errors, len(data.Navigations))
+
+	fmt.Fprintf(out, "\n## Navigations\n\n")
+	if len(data.Navigations) == 0 {
+		fmt.Fprintf(out, "None.\n")
+	}
+	for i, navigation := range data.Navigations {
+		fmt.Fprintf(out, "%d. `%s` %s\n", i+1, navigation.Offset, navigation.URL)
+	}
+
+	fmt.Fprintf(out, "\n## Tool calls\n")
+	if len(data.Calls) == 0 {
+		fmt.Fprintf(out, "\nNo tool calls.\n")
+	}
+	for i, call := range data.Calls {
+		fmt.Fprintf(out, "\n### %d. %s\n\n", i+1, call.Tool)
+		fmt.Fprintf(out, "At `%s`", call.Offset)
+		if call.Duration != "" {
+			fmt.Fprintf(out, ", took %s", call.Duration)
+		}
+		fmt.Fprintf(out, ".\n")
+		if call.Arguments != "" && call.Arguments != "null" && call.Arguments != "{}" {
+			fmt.Fprintf(out, "\n%s\n", fenced("json", call.Arguments))
+		}
+		if call.Error != "" {
+			fmt.Fprintf(out, "\n**Error:**\n\n%s\n", fenced("", truncate(call.Error, transcriptTextLimit)))
+		} else if call.Text != "" {
+			fmt.Fprintf(out, "\n%s\n", fenced("", truncate(call.Text, transcriptTextLimit)))
+		}
+		for j, image := range call.Images {
+			path, err := writeTranscriptImage(string(image), imageDir, fmt.Sprintf("%03d-%d-%s", i+1, j+1, call.Tool))
+			if err != nil {
+				return err
+			}
+			ref, err := filepath.Rel(dir, path)
+			if err != nil {
+				ref = path
+			}
+			fmt.Fprintf(out, "\n![%s](%s)\n", call.Tool, filepath.ToSlash(ref))
+		}
+	}
+
+	if data.HasDiff {
+		fmt.Fprintf(out, "\n## State changes\n\n")
+		if len(data.StateDiff) == 0 {
+			fmt.Fprintf(out, "No changes.\n")
+		}
+		for _, change := range data.StateDiff {
+			fmt.Fprintf(out, "- %s: %s\n", change.Kind, change.Item)
+		}
+	}
+	return out.Flush()
+}
+
+// fenced puts text in a code block whose fence does not occur in it
+func fenced(language, text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + text + "\n" + fence
+}
+
+// writeTranscriptImage decodes a data URL of the report into a file named base
+func writeTranscriptImage(url, dir, base string) (string, error) {
+	header, encoded, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ";base64,")
+	if !ok {
+		return "", fmt.Errorf("unsupported image URL")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid image data: %v", err)
+	}
+	ext := ".png"
+	if header == "image/jpeg" {
+		ext = ".jpg"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, base+ext)
+	return path, os.WriteFile(path, data, 0600)
+}
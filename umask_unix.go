@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const umaskSupported = true
+
+// startWithUmask starts cmd through a shell that sets the umask to mask and then execs
+// the command, so the mask applies to the child alone and not to the wrapper's own
+// files written meanwhile
+func startWithUmask(cmd *exec.Cmd, mask int) error {
+	cmd.Args = append([]string{"sh", "-c", fmt.Sprintf(`umask %03o && exec "$0" "$@"`, mask), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return cmd.Start()
+}
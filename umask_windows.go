@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// Windows has no umask; files get the permissions of their directory
+const umaskSupported = false
+
+func startWithUmask(cmd *exec.Cmd, mask int) error {
+	return cmd.Start()
+}
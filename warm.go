@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// defaultBrowser is the browser @playwright/mcp uses when none is configured
+const defaultBrowser = "chrome"
+
+// runWarm implements "playwrightwrap warm", downloading the MCP package and the
+// configured browsers ahead of the first session
+func runWarm(args []string) int {
+	flags := flag.NewFlagSet("warm", flag.ContinueOnError)
+	browsers := flags.String("browsers", "", "comma separated browsers to install, those of all configured profiles when empty")
+	withDeps := flags.Bool("with-deps", false, "also install the browsers' system dependencies")
+	profile := flags.String("profile", profileName(), "profile whose environment settings apply")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	browserList := splitList(*browsers)
+	if len(browserList) == 0 {
+		browserList = config.browsers()
+	}
+
+	// Install where sessions will look for the browsers
+	env, _ := config.childEnv(*profile)
+
+	if _, _, err := checkNode(); err != nil {
+		fmt.Fprintf(os.Stderr, "playwrightwrap: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Resolving %s\n", config.mcpPackageSpec())
+	if err := runNpx(env, "--yes", config.mcpPackageSpec(), "--version"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve %s: %v\n", mcpPackage, err)
+		return 1
+	}
+
+	if len(browserList) == 0 {
+		fmt.Fprintln(os.Stderr, "No browsers to install, every profile uses its own executable")
+		return 0
+	}
+
+	// Use the playwright CLI bundled with the MCP package so browser builds match its version
+	install := []string{"--yes", "--package", config.mcpPackageSpec(), "playwright", "install"}
+	if *withDeps {
+		install = append(install, "--with-deps")
+	}
+	install = append(install, browserList...)
+	fmt.Fprintf(os.Stderr, "Installing browsers: %v\n", browserList)
+	if err := runNpx(env, install...); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to install browsers: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Caches are warm")
+	return 0
+}
+
+// runNpx runs npx with the wrapper's stdio and the given environment
+func runNpx(env []string, args ...string) error {
+	cmd := exec.Command("npx", args...)
+	cmd.Env = env
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// browsers returns the distinct browsers used by the configured profiles. Profiles with
+// their own executable need no download.
+func (c *Config) browsers() []string {
+	set := map[string]bool{defaultBrowser: len(c.Profiles) == 0}
+	for _, profile := range c.Profiles {
+		if profile != nil && profile.ExecutablePath != "" {
+			continue
+		}
+		if profile == nil || profile.Browser == "" {
+			set[defaultBrowser] = true
+		} else {
+			set[profile.Browser] = true
+		}
+	}
+	var browsers []string
+	for browser, used := range set {
+		if used {
+			browsers = append(browsers, browser)
+		}
+	}
+	sort.Strings(browsers)
+	return browsers
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// wrapFlagPrefix is reserved for the wrapper; no argument starting with it reaches the child
+const wrapFlagPrefix = "--wrap-"
+
+// wrapFlag is a wrapper option on the command line, equivalent to an environment variable
+type wrapFlag struct {
+	env        string
+	takesValue bool
+	usage      string
+	// hidden flags are left out of error messages
+	hidden bool
+}
+
+// wrapFlags are the known --wrap-* flags, keyed by the name after the prefix
+var wrapFlags = map[string]wrapFlag{
+	"config":   {env: "PLAYWRIGHTWRAP_CONFIG", takesValue: true, usage: "config file"},
+	"profile":  {env: "PLAYWRIGHTWRAP_PROFILE", takesValue: true, usage: "profile to run"},
+	"rotation": {env: "PLAYWRIGHTWRAP_ROTATION", takesValue: true, usage: "rotation to pick the profile from"},
+	"record":   {env: "PLAYWRIGHTWRAP_RECORD", takesValue: true, usage: "file to record the session to"},
+	"fixture":  {env: "PLAYWRIGHTWRAP_FIXTURE", takesValue: true, usage: "recording to serve instead of a browser"},
+	"log":      {env: "PLAYWRIGHTWRAPLOG", usage: "write the session log"},
+	// deterministic freezes the clock and names for golden-file tests of the output
+	"deterministic": {env: "PLAYWRIGHTWRAP_DETERMINISTIC", usage: "deterministic output", hidden: true},
+}
+
+// parseWrapFlags removes the --wrap-* flags from args and applies them as their
+// environment variables, which they take precedence over. Any other --wrap-* flag is an
+// error, so a future wrapper option never reaches the child by accident.
+func parseWrapFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, wrapFlagPrefix) {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, wrapFlagPrefix), "=")
+		flag, ok := wrapFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown wrapper flag %s%s, expected one of %s", wrapFlagPrefix, name, strings.Join(wrapFlagNames(), ", "))
+		}
+		switch {
+		case flag.takesValue && !hasValue:
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s%s needs a value: the %s", wrapFlagPrefix, name, flag.usage)
+			}
+			i++
+			value = args[i]
+		case !flag.takesValue && hasValue:
+			return nil, fmt.Errorf("%s%s does not take a value", wrapFlagPrefix, name)
+		case !flag.takesValue:
+			value = "1"
+		}
+		os.Setenv(flag.env, value)
+	}
+	return rest, nil
+}
+
+func wrapFlagNames() []string {
+	names := make([]string, 0, len(wrapFlags))
+	for name, flag := range wrapFlags {
+		if !flag.hidden {
+			names = append(names, wrapFlagPrefix+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}